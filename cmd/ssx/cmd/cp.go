@@ -9,11 +9,20 @@ import (
 func newCpCmd() *cobra.Command {
 	opt := &ssx.CpOption{}
 	cmd := &cobra.Command{
-		Use:   "cp <SOURCE> <TARGET>",
+		Use:   "cp <SOURCE>... <TARGET>",
 		Short: "copy files between local and remote hosts",
-		Long: `Copy files between local and remote hosts using SCP protocol.
+		Long: `Copy files between local and remote hosts using SFTP protocol,
+SCP protocol can be chosen by --protocol for servers without SFTP.
 Supports local-to-remote, remote-to-local, and remote-to-remote transfers.
 
+Progress of transfer is shown as a bar on terminal, or logged periodically
+if stderr is not a terminal, use --quiet to turn it off.
+
+Multiple sources can be given, which must be all local or on the same
+remote host, and the target must be an existing directory then. Glob
+patterns of remote sources are expanded on the server, quote them to
+prevent the local shell from expanding.
+
 For remote-to-remote transfers, files are streamed through ssx without
 being stored locally, acting as a relay between the two remote hosts.
 
@@ -35,15 +44,26 @@ Examples:
   ssx cp root@192.168.1.100:/tmp/file.txt root@192.168.1.200:/tmp/file.txt
   ssx cp server1:/data/file.txt server2:/backup/file.txt
 
+  # Copy multiple files, or files matching the remote glob pattern into directory
+  ssx cp a.log b.log myserver:/tmp/
+  ssx cp 'myserver:/var/log/app/*.log' ./logs/
+
+  # Copy directory recursively, symlinks inside are preserved unless -L is specified
+  ssx cp -r ./dist myserver:/srv/app/
+  ssx cp -r -L myserver:/etc/nginx ./backup/
+
+  # Continue the interrupted copy, and verify the checksum after copied
+  ssx cp --resume --verify myserver:/data/backup.tar.gz ./
+
   # With custom port
   ssx cp ./local.txt root@192.168.1.100:2222:/tmp/remote.txt
 
   # With identity file
   ssx cp -i ~/.ssh/id_rsa ./local.txt root@192.168.1.100:/tmp/remote.txt`,
-		Args: cobra.ExactArgs(2),
+		Args: cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			opt.Source = args[0]
-			opt.Target = args[1]
+			opt.Sources = args[:len(args)-1]
+			opt.Target = args[len(args)-1]
 			return ssxInst.Copy(cmd.Context(), opt)
 		},
 	}
@@ -51,6 +71,12 @@ Examples:
 	cmd.Flags().StringVarP(&opt.IdentityFile, "identity-file", "i", "", "identity file path for authentication")
 	cmd.Flags().StringVarP(&opt.JumpServers, "jump-server", "J", "", "jump servers (proxy)")
 	cmd.Flags().IntVarP(&opt.Port, "port", "P", 22, "port to connect to on the remote host")
+	cmd.Flags().BoolVarP(&opt.Recursive, "recursive", "r", false, "copy directories recursively")
+	cmd.Flags().BoolVarP(&opt.FollowSymlinks, "follow-symlinks", "L", false, "copy the targets of symlinks in directories instead of the symlinks")
+	cmd.Flags().BoolVarP(&opt.Quiet, "quiet", "q", false, "do not show progress")
+	cmd.Flags().BoolVar(&opt.Resume, "resume", false, "continue from the existing partial file of target")
+	cmd.Flags().BoolVar(&opt.Verify, "verify", false, "compare SHA-256 checksums of source and target after copied")
+	cmd.Flags().StringVar(&opt.Protocol, "protocol", ssx.ProtocolSFTP, "transfer protocol, sftp or scp")
 
 	return cmd
 }
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vimiix/ssx/ssx"
+)
+
+func newHistoryCmd() *cobra.Command {
+	var (
+		opt   = &ssx.HistoryOption{}
+		since string
+	)
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "show connection history",
+		Example: `# Show the latest connections
+ssx history
+
+# Show connections to entries tagged with 'prod' in the last 7 days
+ssx history -t prod --since 7d
+
+# Output in JSON format
+ssx history --id 1 --since 2024-01-02 --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := ssx.ParseSince(since, time.Now())
+			if err != nil {
+				return err
+			}
+			opt.Since = t
+			return ssxInst.History(opt)
+		},
+	}
+	cmd.Flags().Uint64Var(&opt.EntryID, "id", 0, "only show connections to the entry")
+	cmd.Flags().StringVarP(&opt.Tag, "tag", "t", "", "only show connections to entries with tag")
+	cmd.Flags().StringVar(&since, "since", "", "only show connections started after the time\nformat: duration like 24h, 7d or date time like 2006-01-02, 2006-01-02 15:04")
+	cmd.Flags().IntVarP(&opt.Limit, "limit", "n", 50, "show at most n latest connections, 0 means no limit")
+	cmd.Flags().BoolVar(&opt.JSON, "json", false, "output in JSON format")
+	return cmd
+}
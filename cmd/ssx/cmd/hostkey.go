@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vimiix/ssx/ssx"
+)
+
+func newHostKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hostkey",
+		Short: "manage known_hosts keys of entries",
+		Example: `# List host keys of all entries
+ssx hostkey list
+
+# Show host keys of an entry
+ssx hostkey show --id <ENTRY_ID>
+
+# Forget the host keys of an entry, e.g. the host was reinstalled
+ssx hostkey remove --id <ENTRY_ID>
+
+# Fetch and trust the current host key, optionally pin its fingerprint in entry
+ssx hostkey accept --id <ENTRY_ID> [--pin]`,
+	}
+	cmd.AddCommand(newHostKeyListCmd())
+	cmd.AddCommand(newHostKeyShowCmd())
+	cmd.AddCommand(newHostKeyRemoveCmd())
+	cmd.AddCommand(newHostKeyAcceptCmd())
+	return cmd
+}
+
+func newHostKeyListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l", "ls"},
+		Short:   "list known_hosts keys of all entries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.ListHostKeys()
+		},
+	}
+}
+
+func newHostKeyShowCmd() *cobra.Command {
+	var id int
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "show known_hosts keys of entry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.ShowHostKeys(id)
+		},
+	}
+	cmd.Flags().IntVarP(&id, "id", "", 0, "entry id")
+	_ = cmd.MarkFlagRequired("id")
+	return cmd
+}
+
+func newHostKeyRemoveCmd() *cobra.Command {
+	var id int
+	cmd := &cobra.Command{
+		Use:     "remove",
+		Aliases: []string{"rm"},
+		Short:   "remove known_hosts keys of entry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.RemoveHostKeys(id)
+		},
+	}
+	cmd.Flags().IntVarP(&id, "id", "", 0, "entry id")
+	_ = cmd.MarkFlagRequired("id")
+	return cmd
+}
+
+func newHostKeyAcceptCmd() *cobra.Command {
+	opt := &ssx.AcceptHostKeyOption{}
+	cmd := &cobra.Command{
+		Use:   "accept",
+		Short: "fetch current host key of entry and trust it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.AcceptHostKey(cmd.Context(), opt)
+		},
+	}
+	cmd.Flags().IntVarP(&opt.ID, "id", "", 0, "entry id")
+	cmd.Flags().BoolVar(&opt.Pin, "pin", false, "pin the fingerprint in entry as well")
+	cmd.Flags().BoolVarP(&opt.Yes, "yes", "y", false, "trust the key without confirmation")
+	_ = cmd.MarkFlagRequired("id")
+	return cmd
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/vimiix/ssx/ssx"
@@ -29,6 +31,17 @@ func newInfoCmd() *cobra.Command {
 				return err
 			}
 			fmt.Println(string(bs))
+			for _, cert := range e.Certificates() {
+				validBefore := "forever"
+				if !cert.ValidBefore.IsZero() {
+					validBefore = cert.ValidBefore.Local().Format(time.RFC3339)
+				}
+				if cert.Expired {
+					validBefore += " (expired)"
+				}
+				fmt.Printf("certificate: %s, key id: %q, principals: %s, valid before: %s\n",
+					cert.Path, cert.KeyID, strings.Join(cert.Principals, ","), validBefore)
+			}
 			return nil
 		}}
 	cmd.Flags().Uint64VarP(&opt.EntryID, "id", "", 0, "entry id")
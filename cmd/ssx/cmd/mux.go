@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newMuxCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mux",
+		Short: "manage background masters sharing connections of entries",
+		Long: `When SSX_MUX is set, the first login of a stored entry starts a master in
+background which keeps the authenticated connection, later ssx invocations
+of the same entry reuse it without dialing and authenticating again.
+The master exits after idle for SSX_MUX_IDLE_TIMEOUT (default 10m).`,
+		Example: `# Show running masters
+ssx mux status
+
+# Stop the master of an entry, or all masters if no id specified
+ssx mux stop [--id <ENTRY_ID>]`,
+	}
+	cmd.AddCommand(newMuxStatusCmd())
+	cmd.AddCommand(newMuxStopCmd())
+	cmd.AddCommand(newMuxServeCmd())
+	return cmd
+}
+
+func newMuxStatusCmd() *cobra.Command {
+	var ids []int
+	cmd := &cobra.Command{
+		Use:     "status",
+		Aliases: []string{"st"},
+		Short:   "show running masters",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.MuxStatus(ids...)
+		},
+	}
+	cmd.Flags().IntSliceVarP(&ids, "id", "", nil, "entry id")
+	return cmd
+}
+
+func newMuxStopCmd() *cobra.Command {
+	var ids []int
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "stop running masters",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.StopMux(ids...)
+		},
+	}
+	cmd.Flags().IntSliceVarP(&ids, "id", "", nil, "entry id")
+	return cmd
+}
+
+// newMuxServeCmd is the entrypoint of master process, started by ssx itself
+func newMuxServeCmd() *cobra.Command {
+	var id int
+	cmd := &cobra.Command{
+		Use:    "serve",
+		Short:  "run master of entry in foreground",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.ServeMux(cmd.Context(), id)
+		},
+	}
+	cmd.Flags().IntVarP(&id, "id", "", 0, "entry id")
+	_ = cmd.MarkFlagRequired("id")
+	return cmd
+}
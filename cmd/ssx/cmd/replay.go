@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vimiix/ssx/ssx"
+)
+
+func newReplayCmd() *cobra.Command {
+	var (
+		speed     float64
+		idleLimit time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "replay FILE",
+		Short: "replay recorded session",
+		Example: `# Replay in double speed, pauses longer than 2 seconds are shortened
+ssx replay 20240102-150405_1.cast --speed 2 --idle-limit 2s`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssx.Replay(cmd.Context(), args[0], speed, idleLimit)
+		},
+	}
+	cmd.Flags().Float64Var(&speed, "speed", 1, "playback speed")
+	cmd.Flags().DurationVar(&idleLimit, "idle-limit", 0, "shorten pauses longer than the limit, 0 means no limit")
+	return cmd
+}
+
+func newRecordingsCmd() *cobra.Command {
+	var id uint64
+	cmd := &cobra.Command{
+		Use:   "recordings",
+		Short: "list recorded sessions",
+		Example: `# Record a session
+ssx --id 1 --record
+
+# List recordings of entry
+ssx recordings --id 1`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssx.PrintRecordings(id)
+		},
+	}
+	cmd.Flags().Uint64Var(&id, "id", 0, "only list recordings of the entry")
+	return cmd
+}
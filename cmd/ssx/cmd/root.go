@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/vimiix/ssx/internal/lg"
@@ -15,6 +17,7 @@ import (
 var (
 	logVerbose   bool
 	printVersion bool
+	legacyTag    string
 	ssxInst      *ssx.SSX
 )
 
@@ -43,7 +46,22 @@ ssx 100
 # If a command is specified, it will be executed on the remote host instead of a login shell.
 ssx 100 -c pwd
 # if the '-c' is omitted, the secend and subsequent arguments will be treated as COMMAND
-ssx 100 pwd`,
+ssx 100 pwd
+# Stdin is forwarded to the command, and --tty allocates a terminal for commands like top
+tar c . | ssx 100 'tar x -C /tmp/dst'
+ssx 100 --tty top
+
+# Run the saved snippet 'disk', see 'ssx snippet'
+ssx 100 @disk
+
+# Forward local port 5432 to the database behind the server without opening a shell
+ssx 100 -N -L 5432:db.internal:5432
+# Unix sockets are supported as well
+ssx 100 -N -L /tmp/docker.sock:/var/run/docker.sock
+# Let the server reach the web service listening on local port 3000 by its port 8080
+ssx 100 -R 8080:localhost:3000
+# Browse internal web UIs through the SOCKS5 proxy on local port 1080
+ssx prod-bastion -N -D 1080`,
 		SilenceUsage:       true,
 		SilenceErrors:      true,
 		DisableAutoGenTag:  true,
@@ -51,6 +69,9 @@ ssx 100 pwd`,
 		Args:               cobra.ArbitraryArgs, // accept arbitrary args for supporting quick login
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			lg.SetVerbose(logVerbose)
+			if f := cmd.Flags().Lookup("legacy-tag"); f != nil && f.Changed {
+				return errors.New("-t is no longer supported, use --tag to search entry by tag, or --tty to force pseudo terminal allocation")
+			}
 			if !printVersion && cmd.Use != "upgrade" {
 				s, err := ssx.NewSSX(opt)
 				if err != nil {
@@ -65,6 +86,19 @@ ssx 100 pwd`,
 				fmt.Fprintln(os.Stdout, version.Detail())
 				return nil
 			}
+
+			// @NAME runs the snippet, the following arguments are its parameters
+			for i, arg := range args[:min(len(args), 2)] {
+				if strings.HasPrefix(arg, "@") {
+					opt.Snippet = strings.TrimPrefix(arg, "@")
+					if opt.Snippet == "" {
+						return errors.New("snippet name is missing after '@', e.g. 'ssx web1 @disk'")
+					}
+					opt.SnippetParams = args[i+1:]
+					args = args[:i]
+					break
+				}
+			}
 			if len(args) > 0 {
 				// just use first word as search key
 				opt.Keyword = args[0]
@@ -78,13 +112,28 @@ ssx 100 pwd`,
 	root.Flags().StringVarP(&opt.DBFile, "file", "f", "", "filepath to store auth data")
 	root.Flags().Uint64VarP(&opt.EntryID, "id", "", 0, "entry id")
 	root.Flags().StringVarP(&opt.Addr, "server", "s", "", "target server address\nsupport format: [user@]host[:port]")
-	root.Flags().StringVarP(&opt.Tag, "tag", "t", "", "search entry by tag")
+	root.Flags().StringVar(&opt.Tag, "tag", "", "search entry by tag")
+	// -t was the shorthand of --tag, it is rejected rather than reused by --tty,
+	// so that existing scripts do not silently change the meaning
+	root.Flags().StringVarP(&legacyTag, "legacy-tag", "t", "", "")
+	_ = root.Flags().MarkHidden("legacy-tag")
 	root.Flags().StringVarP(&opt.IdentityFile, "identity-file", "i", "", "identity_file path")
 	root.Flags().StringVarP(&opt.JumpServers, "jump-server", "J", "", "jump servers, multiple jump hops may be specified separated by comma characters\nformat: [user1@]host1[:port1][,[user2@]host2[:port2]...]")
 	root.Flags().StringVarP(&opt.Command, "cmd", "c", "", "excute the command and exit")
 	root.Flags().DurationVar(&opt.Timeout, "timeout", 0, "timeout for connecting and executing command")
+	root.Flags().StringVar(&opt.TimeoutSignal, "timeout-signal", "TERM", "signal sent to the command when timed out")
+	root.Flags().DurationVar(&opt.GracePeriod, "grace-period", 5*time.Second, "time to wait for the command to exit after signal sent, then close the session")
 	root.Flags().IntVarP(&opt.Port, "port", "p", 22, "port to connect to on the remote host")
 	root.Flags().BoolVar(&opt.Unsafe, "unsafe", false, "store host secret information with unsafe format")
+	root.Flags().StringArrayVarP(&opt.LocalForwards, "local-forward", "L", nil, "forward local port or unix socket to the remote side, can be specified multiple times\nformat: [bind_address:]port:host:hostport, [bind_address:]port:remote_socket,\nlocal_socket:host:hostport or local_socket:remote_socket")
+	root.Flags().StringArrayVarP(&opt.RemoteForwards, "remote-forward", "R", nil, "forward remote port or unix socket to the local side, can be specified multiple times\nformat: [bind_address:]port:host:hostport, [bind_address:]port:local_socket,\nremote_socket:host:hostport or remote_socket:local_socket")
+	root.Flags().StringArrayVarP(&opt.DynamicForwards, "dynamic-forward", "D", nil, "run a local SOCKS5 proxy tunneling connections through the server, can be specified multiple times\nformat: [bind_address:]port")
+	root.Flags().BoolVar(&opt.ForceTTY, "tty", false, "force pseudo terminal allocation for the command")
+	root.Flags().BoolVarP(&opt.DisableTTY, "no-tty", "T", false, "disable pseudo terminal allocation")
+	root.Flags().BoolVar(&opt.Record, "record", false, "record the interactive session into asciicast file, see 'ssx recordings'")
+	root.Flags().BoolVar(&opt.NoStartup, "no-startup", false, "do not run the startup command of entry, start login shell instead")
+	root.Flags().BoolVar(&opt.Reconnect, "reconnect", false, "reconnect the interactive session automatically when connection lost")
+	root.Flags().BoolVarP(&opt.NoCommand, "no-command", "N", false, "do not execute remote command or open a shell, just keep forwarding")
 
 	root.PersistentFlags().BoolVarP(&printVersion, "version", "v", false, "print ssx version")
 	root.PersistentFlags().BoolVar(&logVerbose, "verbose", false, "output detail logs")
@@ -95,6 +144,14 @@ ssx 100 pwd`,
 	root.AddCommand(newInfoCmd())
 	root.AddCommand(newUpgradeCmd())
 	root.AddCommand(newCpCmd())
+	root.AddCommand(newUpdateCmd())
+	root.AddCommand(newHostKeyCmd())
+	root.AddCommand(newMuxCmd())
+	root.AddCommand(newRunCmd())
+	root.AddCommand(newReplayCmd())
+	root.AddCommand(newRecordingsCmd())
+	root.AddCommand(newHistoryCmd())
+	root.AddCommand(newSnippetCmd())
 
 	// no longer needed, hidden them for backwards compatibility
 	_ = root.Flags().MarkDeprecated("server", "it will remove in the future")
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vimiix/ssx/ssx"
+)
+
+func newRunCmd() *cobra.Command {
+	opt := &ssx.RunOption{}
+	cmd := &cobra.Command{
+		Use:   "run [KEYWORD] [-- COMMAND]",
+		Short: "run command on multiple entries concurrently",
+		Example: `# Run on all entries tagged with 'web'
+ssx run -t web -c 'uptime'
+
+# Run on the given entries
+ssx run --id 1,2,3 -- df -h
+
+# Run on all entries matched by keyword, the rest arguments are treated as command
+ssx run 192.168.1 uptime`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var command []string
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				command = args[dash:]
+				args = args[:dash]
+			}
+			if len(args) > 0 && opt.Tag == "" && len(opt.IDs) == 0 {
+				opt.Keyword = args[0]
+				args = args[1:]
+			}
+			command = append(args, command...)
+			if opt.Command == "" {
+				opt.Command = strings.Join(command, " ")
+			}
+			return ssxInst.Run(cmd.Context(), opt)
+		},
+	}
+	cmd.Flags().StringVarP(&opt.Tag, "tag", "t", "", "run on all entries with tag")
+	cmd.Flags().IntSliceVarP(&opt.IDs, "id", "", nil, "entry id")
+	cmd.Flags().StringVarP(&opt.Command, "cmd", "c", "", "command to run")
+	cmd.Flags().IntVarP(&opt.Parallel, "parallel", "P", ssx.DefaultParallel, "maximum number of entries running at the same time")
+	cmd.Flags().DurationVar(&opt.Timeout, "timeout", 0, "timeout for connecting and executing command on each entry")
+	cmd.Flags().StringVar(&opt.TimeoutSignal, "timeout-signal", "TERM", "signal sent to the command when timed out")
+	cmd.Flags().DurationVar(&opt.GracePeriod, "grace-period", 5*time.Second, "time to wait for the command to exit after signal sent, then close the session")
+	return cmd
+}
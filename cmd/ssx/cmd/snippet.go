@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vimiix/ssx/ssx"
+	"github.com/vimiix/ssx/ssx/snippet"
+)
+
+func newSnippetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snippet",
+		Short: "manage saved command snippets",
+		Example: `# Save a global snippet
+ssx snippet add disk -c 'df -h'
+
+# Save a snippet for entries tagged with 'db', which takes precedence over the global one
+ssx snippet add disk -t db -c 'df -h /data'
+
+# Snippets can take parameters, entry fields {{.Host}}, {{.Port}}, {{.User}} and {{.ID}} are builtin
+ssx snippet add tail --id 1 -c 'tail -n {{.Lines}} /var/log/app/{{.Host}}.log'
+
+# Parameter values are not escaped, quote them for the shell by 'quote'
+ssx snippet add search -c 'grep -rn {{quote .Pattern}} /var/log/app'
+
+# List snippets available on an entry
+ssx snippet list --id 1
+
+# Run snippet on entry, the following shortcut is the same
+ssx snippet run tail web1 Lines=100
+ssx web1 @tail Lines=100
+
+# Remove the snippet of tag 'db'
+ssx snippet rm disk -t db`,
+	}
+	cmd.AddCommand(newSnippetAddCmd())
+	cmd.AddCommand(newSnippetListCmd())
+	cmd.AddCommand(newSnippetRemoveCmd())
+	cmd.AddCommand(newSnippetRunCmd())
+	return cmd
+}
+
+func newSnippetAddCmd() *cobra.Command {
+	sn := &snippet.Snippet{}
+	cmd := &cobra.Command{
+		Use:   "add NAME -c COMMAND",
+		Short: "add snippet, the one with the same name and scope is replaced",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sn.Name = args[0]
+			return ssxInst.AddSnippet(sn)
+		},
+	}
+	cmd.Flags().StringVarP(&sn.Command, "cmd", "c", "", "command of snippet, which is a go template")
+	cmd.Flags().Uint64Var(&sn.EntryID, "id", 0, "attach snippet to the entry")
+	cmd.Flags().StringVarP(&sn.Tag, "tag", "t", "", "attach snippet to entries with the tag")
+	_ = cmd.MarkFlagRequired("cmd")
+	return cmd
+}
+
+func newSnippetListCmd() *cobra.Command {
+	var (
+		id  uint64
+		tag string
+	)
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l", "ls"},
+		Short:   "list snippets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.ListSnippets(id, tag)
+		},
+	}
+	cmd.Flags().Uint64Var(&id, "id", 0, "only list snippets available on the entry")
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "only list snippets attached to the tag")
+	return cmd
+}
+
+func newSnippetRemoveCmd() *cobra.Command {
+	var (
+		id  uint64
+		tag string
+	)
+	cmd := &cobra.Command{
+		Use:     "remove NAME",
+		Aliases: []string{"rm"},
+		Short:   "remove snippet, the global one is removed if neither --id nor --tag specified",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ssxInst.DeleteSnippet(args[0], id, tag)
+		},
+	}
+	cmd.Flags().Uint64Var(&id, "id", 0, "remove snippet attached to the entry")
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "remove snippet attached to the tag")
+	return cmd
+}
+
+func newSnippetRunCmd() *cobra.Command {
+	opt := &ssx.SnippetRunOption{}
+	cmd := &cobra.Command{
+		Use:   "run NAME [KEYWORD] [KEY=VALUE...]",
+		Short: "run snippet on entry",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opt.Name = args[0]
+			args = args[1:]
+			if len(args) > 0 && !strings.Contains(args[0], "=") {
+				opt.Keyword = args[0]
+				args = args[1:]
+			}
+			opt.Params = args
+			return ssxInst.RunSnippet(cmd.Context(), opt)
+		},
+	}
+	cmd.Flags().Uint64Var(&opt.EntryID, "id", 0, "entry id")
+	cmd.Flags().DurationVar(&opt.Timeout, "timeout", 0, "timeout for connecting and executing command")
+	return cmd
+}
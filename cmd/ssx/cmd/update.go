@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/vimiix/ssx/internal/slice"
+	"github.com/vimiix/ssx/internal/totp"
+	"github.com/vimiix/ssx/internal/utils"
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+func newUpdateCmd() *cobra.Command {
+	var (
+		id           int
+		hop          int
+		disableAgent bool
+		totpSecret   string
+		certFile     string
+		identityFile string
+		hkPolicy     string
+		khFile       string
+		fingerprint  string
+		setEnv       []string
+		sendEnv      []string
+		unsetEnv     []string
+		record       bool
+		startupCmd   string
+		startupFile  string
+	)
+	cmd := &cobra.Command{
+		Use:     "update",
+		Aliases: []string{"u"},
+		Short:   "update settings of entry by id",
+		Example: `# Turn off ssh-agent authentication for entry and its jump servers
+ssx update --id <ENTRY_ID> --disable-agent
+
+# Login the first jump server with a private key
+ssx update --id <ENTRY_ID> --hop 1 -i ~/.ssh/bastion_ed25519
+
+# Require the host key to be known already
+ssx update --id <ENTRY_ID> --host-key-policy strict --known-hosts-file /etc/ssh/prod_known_hosts
+
+# Send LANG and KUBECONFIG on login, and pass through all local LC_* variables
+ssx update --id <ENTRY_ID> --set-env LANG=en_US.UTF-8 --set-env KUBECONFIG=/etc/kube/prod.yaml --send-env 'LC_*'
+
+# Record every interactive session of entry for auditing
+ssx update --id <ENTRY_ID> --record
+
+# Become root right after login, pass an empty value to remove it
+ssx update --id <ENTRY_ID> --startup-command 'sudo -i'
+
+# Enter the app directory, the login shell has to be started explicitly
+ssx update --id <ENTRY_ID> --startup-command 'cd /srv/app && exec $SHELL -l'
+
+# Store the TOTP seed of the first jump server, pass an empty value to remove it
+ssx update --id <ENTRY_ID> --hop 1 --totp-secret <BASE32_SEED>`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var changes []func(e *entry.Entry) error
+			if cmd.Flags().Changed("disable-agent") {
+				changes = append(changes, func(e *entry.Entry) error {
+					e.DisableAgent = disableAgent
+					if e.Proxy != nil {
+						e.Proxy.SetDisableAgent(disableAgent)
+					}
+					return nil
+				})
+			}
+			if cmd.Flags().Changed("identity-file") {
+				if identityFile != "" && !utils.FileExists(identityFile) {
+					return errors.Errorf("file not found: %s", identityFile)
+				}
+				keyPath := utils.ExpandHomeDir(identityFile)
+				changes = append(changes, applyToHop(hop,
+					func(e *entry.Entry) { e.KeyPath, e.Passphrase = keyPath, "" },
+					func(p *entry.Proxy) { p.KeyPath, p.Passphrase = keyPath, "" },
+				))
+			}
+			if cmd.Flags().Changed("cert-file") {
+				if certFile != "" && !utils.FileExists(certFile) {
+					return errors.Errorf("file not found: %s", certFile)
+				}
+				changes = append(changes, applyToHop(hop,
+					func(e *entry.Entry) { e.CertificateFile = certFile },
+					func(p *entry.Proxy) { p.CertificateFile = certFile },
+				))
+			}
+			if cmd.Flags().Changed("totp-secret") {
+				if totpSecret != "" {
+					if _, err := totp.DecodeSecret(totpSecret); err != nil {
+						return err
+					}
+				}
+				changes = append(changes, applyToHop(hop,
+					func(e *entry.Entry) { e.TOTPSecret = totpSecret },
+					func(p *entry.Proxy) { p.TOTPSecret = totpSecret },
+				))
+			}
+			if cmd.Flags().Changed("host-key-policy") {
+				if err := entry.ValidateHostKeyPolicy(hkPolicy); err != nil {
+					return err
+				}
+				changes = append(changes, applyToHop(hop,
+					func(e *entry.Entry) { e.HostKeyPolicy = hkPolicy },
+					func(p *entry.Proxy) { p.HostKeyPolicy = hkPolicy },
+				))
+			}
+			if cmd.Flags().Changed("known-hosts-file") {
+				changes = append(changes, applyToHop(hop,
+					func(e *entry.Entry) { e.KnownHostsFile = khFile },
+					func(p *entry.Proxy) { p.KnownHostsFile = khFile },
+				))
+			}
+			if cmd.Flags().Changed("host-key-fingerprint") {
+				if hop != 0 {
+					return errors.New("pinning host key of jump server is not supported")
+				}
+				if err := entry.ValidateFingerprint(fingerprint); err != nil {
+					return err
+				}
+				changes = append(changes, func(e *entry.Entry) error {
+					e.HostKeyFingerprint = fingerprint
+					return nil
+				})
+			}
+			if len(setEnv) > 0 || len(sendEnv) > 0 || len(unsetEnv) > 0 {
+				if hop != 0 {
+					return errors.New("environment variables of jump server are not supported")
+				}
+				vars := map[string]string{}
+				for _, kv := range setEnv {
+					name, value, err := entry.ParseEnvVar(kv)
+					if err != nil {
+						return err
+					}
+					vars[name] = value
+				}
+				for _, pattern := range sendEnv {
+					if err := entry.ValidateSendEnv(pattern); err != nil {
+						return err
+					}
+				}
+				changes = append(changes, func(e *entry.Entry) error {
+					for _, name := range unsetEnv {
+						delete(e.SetEnv, name)
+					}
+					e.SendEnv = slice.Delete(e.SendEnv, unsetEnv...)
+					if len(vars) > 0 && e.SetEnv == nil {
+						e.SetEnv = map[string]string{}
+					}
+					for name, value := range vars {
+						e.SetEnv[name] = value
+					}
+					e.SendEnv = slice.Distinct(append(e.SendEnv, sendEnv...))
+					return nil
+				})
+			}
+			if cmd.Flags().Changed("record") {
+				changes = append(changes, func(e *entry.Entry) error {
+					e.Record = record
+					return nil
+				})
+			}
+			if cmd.Flags().Changed("startup-command") || cmd.Flags().Changed("startup-script") {
+				if hop != 0 {
+					return errors.New("startup command of jump server is not supported")
+				}
+				if startupFile != "" {
+					bs, err := os.ReadFile(startupFile)
+					if err != nil {
+						return err
+					}
+					startupCmd = string(bs)
+				}
+				changes = append(changes, func(e *entry.Entry) error {
+					e.StartupCommand = startupCmd
+					return nil
+				})
+			}
+			if len(changes) == 0 {
+				fmt.Println("nothing to update")
+				return nil
+			}
+			return ssxInst.UpdateEntryByID(id, changes...)
+		},
+	}
+
+	cmd.Flags().IntVarP(&id, "id", "", 0, "entry id")
+	cmd.Flags().IntVar(&hop, "hop", 0, "apply hop specific settings to the n-th jump server, 0 means the entry itself")
+	cmd.Flags().BoolVar(&disableAgent, "disable-agent", false, "do not authenticate through ssh-agent (SSH_AUTH_SOCK), applies to jump servers too")
+	cmd.Flags().StringVarP(&identityFile, "identity-file", "i", "", "identity_file path")
+	cmd.Flags().StringVar(&certFile, "cert-file", "", "OpenSSH user certificate paired with the identity file")
+	cmd.Flags().StringVar(&totpSecret, "totp-secret", "", "base32 TOTP seed used to answer verification code questions")
+	cmd.Flags().StringVar(&hkPolicy, "host-key-policy", "", "host key checking policy: strict, ask, accept-new or off\nempty means the global setting (env SSX_HOST_KEY_POLICY)")
+	cmd.Flags().StringVar(&khFile, "known-hosts-file", "", "known_hosts file used to verify host key\nempty means the global setting (env SSX_KNOWN_HOSTS_FILE)")
+	cmd.Flags().StringVar(&fingerprint, "host-key-fingerprint", "", "pin the expected SHA256 fingerprint of host key, see also 'ssx hostkey accept --pin'")
+	cmd.Flags().StringArrayVar(&setEnv, "set-env", nil, "environment variable sent on session start, can be specified multiple times\nformat: KEY=VALUE")
+	cmd.Flags().StringArrayVar(&sendEnv, "send-env", nil, "name of local environment variable passed through on session start, can be specified multiple times\nwildcards '*' and '?' are supported")
+	cmd.Flags().StringArrayVar(&unsetEnv, "unset-env", nil, "remove the environment variable set by --set-env or --send-env, can be specified multiple times")
+	cmd.Flags().BoolVar(&record, "record", false, "record interactive sessions of entry, use --record=false to turn off")
+	cmd.Flags().StringVar(&startupCmd, "startup-command", "", "command run in the terminal of interactive login instead of login shell\nlike RemoteCommand with RequestTTY of ssh config, skipped by 'ssx --no-startup'")
+	cmd.Flags().StringVar(&startupFile, "startup-script", "", "read the startup command from the script file")
+	cmd.MarkFlagsMutuallyExclusive("startup-command", "startup-script")
+	_ = cmd.MarkFlagRequired("id")
+	return cmd
+}
+
+// applyToHop returns a change which sets the entry itself when hop is 0,
+// or its n-th jump server otherwise
+func applyToHop(hop int, setEntry func(e *entry.Entry), setProxy func(p *entry.Proxy)) func(e *entry.Entry) error {
+	return func(e *entry.Entry) error {
+		if hop == 0 {
+			setEntry(e)
+			return nil
+		}
+		p, err := e.JumpServer(hop)
+		if err != nil {
+			return err
+		}
+		setProxy(p)
+		return nil
+	}
+}
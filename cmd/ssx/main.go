@@ -4,12 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
 	"syscall"
 
 	"github.com/fatih/color"
 
 	"github.com/vimiix/ssx/cmd/ssx/cmd"
+	"github.com/vimiix/ssx/ssx"
 	"github.com/vimiix/ssx/ssx/cleaner"
 )
 
@@ -18,14 +18,18 @@ func main() {
 		exitCode = 0
 	)
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	// the received signal is forwarded to remote command,
+	// and further ones are ignored until the cleanup has finished
+	ctx, stop := ssx.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	if err := cmd.NewRoot().ExecuteContext(ctx); err != nil {
-		fmt.Println(color.HiRedString(err.Error()))
-		exitCode = 1
+		if !ssx.IsRemoteExit(err) {
+			fmt.Println(color.HiRedString(err.Error()))
+		}
+		exitCode = ssx.ExitCode(err)
 	}
 
 	cleaner.Clean()
+	stop()
 	os.Exit(exitCode)
 }
@@ -0,0 +1,224 @@
+// Package asciicast reads and writes terminal recordings in asciicast v2
+// format of asciinema: https://docs.asciinema.org/manual/asciicast/v2/
+package asciicast
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const version = 2
+
+// Event types
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+)
+
+// Header is the first line of a recording
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a line of recording following the header
+type Event struct {
+	Time float64 // seconds since the beginning of recording
+	Type string
+	Data string
+}
+
+// Writer writes a recording, it is safe for concurrent use
+type Writer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time
+	pending []byte // incomplete utf-8 sequence at the end of last output
+}
+
+// NewWriter writes header to w and returns a Writer
+// whose event times are relative to now
+func NewWriter(w io.Writer, header *Header) (*Writer, error) {
+	start := time.Now()
+	h := *header
+	h.Version = version
+	if h.Timestamp == 0 {
+		h.Timestamp = start.Unix()
+	}
+	b, err := json.Marshal(&h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, start: start}, nil
+}
+
+// Write records p as output, so that Writer can be used with io.MultiWriter
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data := append(w.pending, p...)
+	// a multi-byte character may be split into two writes
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	w.pending = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return len(p), nil
+	}
+	if err := w.writeEvent(EventOutput, string(data[:cut])); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize records the new size of terminal
+func (w *Writer) Resize(width, height int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeEvent(EventResize, fmt.Sprintf("%dx%d", width, height))
+}
+
+func (w *Writer) writeEvent(typ, data string) error {
+	elapsed := time.Since(w.start).Seconds()
+	b, err := json.Marshal([]any{json.Number(strconv.FormatFloat(elapsed, 'f', 6, 64)), typ, data})
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(append(b, '\n'))
+	return err
+}
+
+// Reader reads events of a recording
+type Reader struct {
+	Header  *Header
+	scanner *bufio.Scanner
+}
+
+// NewReader reads header from r and returns a Reader of the following events
+func NewReader(r io.Reader) (*Reader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("empty recording")
+	}
+	header := &Header{}
+	if err := json.Unmarshal(scanner.Bytes(), header); err != nil {
+		return nil, errors.Wrap(err, "invalid header")
+	}
+	if header.Version != version {
+		return nil, errors.Errorf("unsupported asciicast version %d", header.Version)
+	}
+	return &Reader{Header: header, scanner: scanner}, nil
+}
+
+// Next returns the next event, io.EOF is returned at the end
+func (r *Reader) Next() (*Event, error) {
+	for r.scanner.Scan() {
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+		var (
+			fields []json.RawMessage
+			ev     Event
+		)
+		if err := json.Unmarshal([]byte(line), &fields); err != nil || len(fields) != 3 {
+			return nil, errors.Errorf("invalid event %q", line)
+		}
+		if err := json.Unmarshal(fields[0], &ev.Time); err != nil {
+			return nil, errors.Errorf("invalid event time %s", fields[0])
+		}
+		if err := json.Unmarshal(fields[1], &ev.Type); err != nil {
+			return nil, errors.Errorf("invalid event type %s", fields[1])
+		}
+		if err := json.Unmarshal(fields[2], &ev.Data); err != nil {
+			return nil, errors.Errorf("invalid event data %s", fields[2])
+		}
+		return &ev, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Duration reads all the remaining events and returns the time of the last one
+func (r *Reader) Duration() (time.Duration, error) {
+	var last float64
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			return time.Duration(last * float64(time.Second)), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		last = ev.Time
+	}
+}
+
+// Play writes output events of r to w in the recorded pace, speed up
+// by speed times, and pauses longer than idleLimit are shortened to it
+// if idleLimit is positive.
+func Play(ctx context.Context, r *Reader, w io.Writer, speed float64, idleLimit time.Duration) error {
+	if speed <= 0 {
+		return errors.Errorf("invalid speed %v", speed)
+	}
+	var last float64
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		delay := time.Duration((ev.Time - last) / speed * float64(time.Second))
+		if idleLimit > 0 && delay > idleLimit {
+			delay = idleLimit
+		}
+		last = ev.Time
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if ev.Type != EventOutput {
+			continue
+		}
+		if _, err = io.WriteString(w, ev.Data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package asciicast
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterReader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, &Header{Width: 80, Height: 24, Title: "root@host:22", Env: map[string]string{"TERM": "xterm"}})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	_, _ = w.Write([]byte("hello\r\n"))
+	// "你" is split into two writes
+	_, _ = w.Write([]byte{0xe4, 0xbd})
+	_, _ = w.Write([]byte{0xa0, '!'})
+	_ = w.Resize(100, 30)
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, 2, r.Header.Version)
+	assert.Equal(t, 80, r.Header.Width)
+	assert.Equal(t, "root@host:22", r.Header.Title)
+	assert.NotZero(t, r.Header.Timestamp)
+
+	var events []Event
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		events = append(events, *ev)
+	}
+	assert.Len(t, events, 3)
+	assert.Equal(t, EventOutput, events[0].Type)
+	assert.Equal(t, "hello\r\n", events[0].Data)
+	assert.Equal(t, "你!", events[1].Data)
+	assert.Equal(t, EventResize, events[2].Type)
+	assert.Equal(t, "100x30", events[2].Data)
+}
+
+func TestPlay(t *testing.T) {
+	rec := `{"version": 2, "width": 80, "height": 24}
+[0.1, "o", "a"]
+[0.2, "r", "90x30"]
+[5.0, "o", "b\n"]
+`
+	r, err := NewReader(strings.NewReader(rec))
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	var out bytes.Buffer
+	start := time.Now()
+	if err = Play(context.Background(), r, &out, 10, 100*time.Millisecond); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "ab\n", out.String())
+	assert.Less(t, time.Since(start), time.Second)
+
+	_, err = NewReader(strings.NewReader(`{"version": 1, "width": 80, "height": 24}`))
+	assert.Error(t, err)
+}
@@ -59,6 +59,17 @@ func Decrypt(rawCipher string) string {
 	return res
 }
 
+// IsEncrypted reports whether s is a cipher text generated by Encrypt,
+// whose salt is derived from the encrypting time following it
+func IsEncrypted(s string) bool {
+	dec, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(dec) <= 16 {
+		return false
+	}
+	curTime := shiftDecode(string(dec[8:16]))
+	return string(dec[:8]) == md5encode(curTime)[:8]
+}
+
 func md5encode(s string) string {
 	h := md5.New()
 	h.Write([]byte(s))
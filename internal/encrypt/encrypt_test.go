@@ -40,3 +40,22 @@ func TestDecrypt(t *testing.T) {
 		})
 	}
 }
+
+func TestIsEncrypted(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		expect bool
+	}{
+		{"empty", "", false},
+		{"encrypted", Encrypt("abc123"), true},
+		{"stored", "NmUxODZmYWM8PTxFPUQ9QENIQUc2eGl4T2pEWnQtQ0I2YkE0RkRxRUI0ei1fLUlNMmZKYi1lTFlnQk0=", true},
+		{"plaintext", "abc123", false},
+		{"base64 plaintext", "MTIzNDU2Nzg5MDEyMzQ1Njc4OTA=", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, IsEncrypted(tt.text))
+		})
+	}
+}
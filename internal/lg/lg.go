@@ -2,6 +2,7 @@ package lg
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -20,6 +21,16 @@ func SetVerbose(v bool) {
 	verbose.Store(v)
 }
 
+// IsVerbose reports whether debug logs are printed
+func IsVerbose() bool {
+	return verbose.Load()
+}
+
+// SetOutput redirects logs to w
+func SetOutput(w io.Writer) {
+	logger.SetOutput(w)
+}
+
 func defaultPrint(lvl, message string) {
 	ts := time.Now().Format(time.RFC3339)
 	logger.Print(
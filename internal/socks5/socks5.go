@@ -0,0 +1,120 @@
+// Package socks5 implements the server side negotiation of SOCKS5 protocol
+// (RFC 1928) with CONNECT command and no authentication, the connection
+// to the requested address is left to caller.
+package socks5
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	version = 0x05
+
+	methodNoAuth       = 0x00
+	methodNoAcceptable = 0xff
+
+	cmdConnect = 0x01
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+)
+
+// Reply codes
+const (
+	Succeeded               byte = 0x00
+	GeneralFailure          byte = 0x01
+	HostUnreachable         byte = 0x04
+	ConnectionRefused       byte = 0x05
+	CommandNotSupported     byte = 0x07
+	AddressTypeNotSupported byte = 0x08
+)
+
+// Handshake negotiates with the client on conn and returns
+// the address requested by CONNECT command in host:port format.
+// Caller should send a reply by Reply after connecting the address.
+func Handshake(conn net.Conn) (string, error) {
+	// greeting: VER NMETHODS METHODS
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", errors.Wrap(err, "read greeting")
+	}
+	if header[0] != version {
+		return "", errors.Errorf("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", errors.Wrap(err, "read methods")
+	}
+	method := byte(methodNoAcceptable)
+	for _, m := range methods {
+		if m == methodNoAuth {
+			method = methodNoAuth
+			break
+		}
+	}
+	if _, err := conn.Write([]byte{version, method}); err != nil {
+		return "", err
+	}
+	if method == methodNoAcceptable {
+		return "", errors.New("client does not support no authentication method")
+	}
+
+	// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", errors.Wrap(err, "read request")
+	}
+	if req[0] != version {
+		return "", errors.Errorf("unsupported socks version %d", req[0])
+	}
+	if req[1] != cmdConnect {
+		_ = Reply(conn, CommandNotSupported)
+		return "", errors.Errorf("unsupported command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case atypIPv4, atypIPv6:
+		size := net.IPv4len
+		if req[3] == atypIPv6 {
+			size = net.IPv6len
+		}
+		ip := make(net.IP, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", errors.Wrap(err, "read address")
+		}
+		host = ip.String()
+	case atypDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", errors.Wrap(err, "read address")
+		}
+		domain := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", errors.Wrap(err, "read address")
+		}
+		host = string(domain)
+	default:
+		_ = Reply(conn, AddressTypeNotSupported)
+		return "", errors.Errorf("unsupported address type %d", req[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", errors.Wrap(err, "read port")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// Reply sends reply of CONNECT request to client, the bound address
+// is always reported as 0.0.0.0:0 since it is meaningless for tunnels.
+func Reply(conn net.Conn, rep byte) error {
+	_, err := conn.Write([]byte{version, rep, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,108 @@
+package socks5
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// connPair returns both ends of a loopback tcp connection,
+// writes on it do not block like net.Pipe
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	return server, client
+}
+
+func runClient(conn net.Conn, request []byte, replies chan<- []byte) {
+	go func() {
+		defer close(replies)
+		if _, err := conn.Write([]byte{version, 1, methodNoAuth}); err != nil {
+			return
+		}
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		replies <- buf
+		if _, err := conn.Write(request); err != nil {
+			return
+		}
+		buf = make([]byte, 10)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		replies <- buf
+	}()
+}
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		addr    string
+	}{
+		{
+			name:    "ipv4",
+			request: []byte{version, cmdConnect, 0, atypIPv4, 10, 0, 0, 1, 0x1f, 0x90},
+			addr:    "10.0.0.1:8080",
+		},
+		{
+			name:    "domain",
+			request: append(append([]byte{version, cmdConnect, 0, atypDomain, 11}, "example.com"...), 0x01, 0xbb),
+			addr:    "example.com:443",
+		},
+		{
+			name:    "ipv6",
+			request: []byte{version, cmdConnect, 0, atypIPv6, 0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 80},
+			addr:    "[fe80::1]:80",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := connPair(t)
+			defer server.Close()
+			defer client.Close()
+
+			replies := make(chan []byte, 2)
+			runClient(client, tt.request, replies)
+			addr, err := Handshake(server)
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			assert.Equal(t, tt.addr, addr)
+			assert.Equal(t, []byte{version, methodNoAuth}, <-replies)
+
+			assert.NoError(t, Reply(server, Succeeded))
+			assert.Equal(t, Succeeded, (<-replies)[1])
+		})
+	}
+}
+
+func TestHandshake_UnsupportedCommand(t *testing.T) {
+	server, client := connPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	replies := make(chan []byte, 2)
+	// BIND command
+	runClient(client, []byte{version, 0x02, 0, atypIPv4, 10, 0, 0, 1, 0, 80}, replies)
+	_, err := Handshake(server)
+	assert.Error(t, err)
+	<-replies
+	assert.Equal(t, CommandNotSupported, (<-replies)[1])
+}
@@ -1,12 +1,51 @@
 package terminal
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/containerd/console"
+	"golang.org/x/term"
 )
 
+// WindowChanger is notified of size changes of local terminal, *ssh.Session implements it
+type WindowChanger interface {
+	WindowChange(h, w int) error
+}
+
+// ErrPromptDisabled is returned when input is required but prompts are disabled in context
+var ErrPromptDisabled = errors.New("interactive prompt is disabled")
+
+type promptDisabledKey struct{}
+
+// DisablePrompt returns a context in which prompts fail with ErrPromptDisabled
+// instead of reading from stdin, e.g. when stdin is taken by a session
+func DisablePrompt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, promptDisabledKey{}, true)
+}
+
+// CheckPrompt returns ErrPromptDisabled if prompts are disabled in ctx,
+// it is called before printing the prompt
+func CheckPrompt(ctx context.Context) error {
+	if disabled, _ := ctx.Value(promptDisabledKey{}).(bool); disabled {
+		return ErrPromptDisabled
+	}
+	return nil
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
 func ReadPassword(ctx context.Context) ([]byte, error) {
+	if err := CheckPrompt(ctx); err != nil {
+		return nil, err
+	}
 	c := console.Current()
 	defer func() {
 		_ = c.Reset()
@@ -33,3 +72,59 @@ func ReadPassword(ctx context.Context) ([]byte, error) {
 		return nil, ctx.Err()
 	}
 }
+
+var (
+	// stdinReader is shared by all ReadLine calls, so that the input buffered
+	// after a line is not lost
+	stdinReader = bufio.NewReader(os.Stdin)
+
+	lineMu      sync.Mutex
+	pendingLine chan lineResult // the read in progress, taken over by the next call if canceled
+)
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+// ReadLine reads a line of visible input from stdin, the line ending is trimmed.
+// The read is not interrupted if ctx is done, its line is returned by the next call.
+func ReadLine(ctx context.Context) (string, error) {
+	if err := CheckPrompt(ctx); err != nil {
+		return "", err
+	}
+	lineMu.Lock()
+	if pendingLine == nil {
+		ch := make(chan lineResult, 1)
+		pendingLine = ch
+		go func() {
+			line, err := stdinReader.ReadString('\n')
+			if err != nil && line == "" {
+				ch <- lineResult{err: err}
+				return
+			}
+			ch <- lineResult{line: strings.TrimRight(line, "\r\n")}
+		}()
+	}
+	ch := pendingLine
+	lineMu.Unlock()
+
+	select {
+	case r := <-ch:
+		lineMu.Lock()
+		pendingLine = nil
+		lineMu.Unlock()
+		return r.line, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Width returns the width of terminal f, or 80 if unknown
+func Width(f *os.File) int {
+	w, _, err := term.GetSize(int(f.Fd()))
+	if err != nil || w <= 0 {
+		return 80
+	}
+	return w
+}
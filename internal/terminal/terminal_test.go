@@ -0,0 +1,60 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisablePrompt(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, CheckPrompt(ctx))
+
+	ctx = DisablePrompt(ctx)
+	assert.ErrorIs(t, CheckPrompt(ctx), ErrPromptDisabled)
+	_, err := ReadLine(ctx)
+	assert.ErrorIs(t, err, ErrPromptDisabled)
+	_, err = ReadPassword(ctx)
+	assert.ErrorIs(t, err, ErrPromptDisabled)
+}
+
+func TestReadLine(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	orig := stdinReader
+	stdinReader = bufio.NewReader(r)
+	defer func() { stdinReader = orig }()
+
+	// lines written at once are not lost
+	_, _ = w.WriteString("yes\r\nno\n")
+	line, err := ReadLine(context.Background())
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "yes", line)
+	line, err = ReadLine(context.Background())
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "no", line)
+
+	// the line of canceled read is returned by the next call
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ReadLine(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, _ = w.WriteString("later\n")
+	line, err = ReadLine(context.Background())
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "later", line)
+}
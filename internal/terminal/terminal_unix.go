@@ -8,7 +8,6 @@ import (
 	"os/signal"
 	"syscall"
 
-	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 
 	"github.com/vimiix/ssx/internal/lg"
@@ -18,7 +17,7 @@ func readPassword() ([]byte, error) {
 	return term.ReadPassword(syscall.Stdin)
 }
 
-func GetAndWatchWindowSize(ctx context.Context, sess *ssh.Session) (int, int, error) {
+func GetAndWatchWindowSize(ctx context.Context, sess WindowChanger) (int, int, error) {
 	fd := int(os.Stdin.Fd())
 	width, height, err := term.GetSize(fd)
 	if err != nil {
@@ -34,7 +33,7 @@ func GetAndWatchWindowSize(ctx context.Context, sess *ssh.Session) (int, int, er
 	return width, height, nil
 }
 
-func watchWindowSize(ctx context.Context, sess *ssh.Session, fd int) error {
+func watchWindowSize(ctx context.Context, sess WindowChanger, fd int) error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGWINCH)
 
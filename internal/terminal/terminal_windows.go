@@ -6,7 +6,6 @@ import (
 	"context"
 	"time"
 
-	"golang.org/x/crypto/ssh"
 	"golang.org/x/sys/windows"
 	"golang.org/x/term"
 
@@ -17,7 +16,7 @@ func readPassword() ([]byte, error) {
 	return term.ReadPassword(int(windows.Stdin))
 }
 
-func GetAndWatchWindowSize(ctx context.Context, sess *ssh.Session) (int, int, error) {
+func GetAndWatchWindowSize(ctx context.Context, sess WindowChanger) (int, int, error) {
 	fd := windows.Stdout
 	width, height, err := getConsoleSize(fd)
 	if err != nil {
@@ -33,7 +32,7 @@ func GetAndWatchWindowSize(ctx context.Context, sess *ssh.Session) (int, int, er
 	return width, height, nil
 }
 
-func watchWindowSize(ctx context.Context, sess *ssh.Session, fd windows.Handle, width, height int) error {
+func watchWindowSize(ctx context.Context, sess WindowChanger, fd windows.Handle, width, height int) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,61 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Period is the time step of codes in seconds, RFC 6238 default
+	Period = 30
+	// Digits is the length of generated codes
+	Digits = 6
+)
+
+// DecodeSecret decodes a base32 encoded seed as shown by most
+// authenticator apps, spaces, dashes and missing padding are tolerated.
+func DecodeSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	s = strings.TrimRight(s, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid totp secret, expect base32 encoded string")
+	}
+	if len(key) == 0 {
+		return nil, errors.New("empty totp secret")
+	}
+	return key, nil
+}
+
+// Generate returns the time based one-time password of secret at moment t
+func Generate(secret string, t time.Time) (string, error) {
+	key, err := DecodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(t.Unix()/Period), Digits), nil
+}
+
+// hotp implements RFC 4226 with HMAC-SHA1
+func hotp(key []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%mod)
+}
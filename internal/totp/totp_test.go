@@ -0,0 +1,40 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test vectors come from RFC 6238 appendix B (SHA1)
+func TestGenerate(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // base32 of "12345678901234567890"
+	tests := []struct {
+		unix   int64
+		expect string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := Generate(secret, time.Unix(tt.unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expect, code)
+	}
+}
+
+func TestDecodeSecret(t *testing.T) {
+	key, err := DecodeSecret("gezd gnbv-gy3t qojq")
+	assert.NoError(t, err)
+	assert.Equal(t, "1234567890", string(key))
+
+	_, err = DecodeSecret("not base32!")
+	assert.Error(t, err)
+
+	_, err = DecodeSecret("")
+	assert.Error(t, err)
+}
@@ -376,3 +376,9 @@ func HashWithSHA256(input string) string {
 	hashedBytes := hash.Sum(nil)
 	return hex.EncodeToString(hashedBytes)
 }
+
+// ShellQuote quotes s with single quotes for POSIX shell,
+// so that it is passed to the command as a single argument
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -249,3 +249,22 @@ func createTestZip(zipPath string) error {
 
 	return nil
 }
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "''"},
+		{"/tmp/a b", "'/tmp/a b'"},
+		{"it's", `'it'\''s'`},
+		{"$(rm -rf /)", "'$(rm -rf /)'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := ShellQuote(tt.input); got != tt.want {
+				t.Errorf("ShellQuote() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
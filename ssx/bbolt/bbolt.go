@@ -3,6 +3,7 @@ package bbolt
 import (
 	"encoding/binary"
 	"encoding/json"
+	"sync"
 	"time"
 
 	"go.etcd.io/bbolt"
@@ -11,6 +12,8 @@ import (
 	"github.com/vimiix/ssx/internal/errmsg"
 	"github.com/vimiix/ssx/internal/lg"
 	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/history"
+	"github.com/vimiix/ssx/ssx/snippet"
 )
 
 // itob returns an 8-byte big endian representation of v.
@@ -21,195 +24,301 @@ func itob(v uint64) []byte {
 }
 
 type Repo struct {
-	db          *bbolt.DB
-	file        string
-	metaBucket  []byte
-	entryBucket []byte
+	mu            sync.Mutex // serializes withDB
+	file          string
+	metaBucket    []byte
+	entryBucket   []byte
+	historyBucket []byte
+	snippetBucket []byte
 }
 
 func (r *Repo) GetMetadata(key []byte) ([]byte, error) {
-	if err := r.open(); err != nil {
-		return nil, err
-	}
-	defer r.close()
 	var res []byte
 	lg.Debug("bbolt repo: get metadata: %s", string(key))
-	_ = r.db.View(func(tx *bbolt.Tx) error {
-		v := tx.Bucket(r.metaBucket).Get(key)
-		res = make([]byte, len(v))
-		// 'v' is only valid for the life of the transaction
-		copy(res, v)
-		return nil
+	err := r.withDB(func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			v := tx.Bucket(r.metaBucket).Get(key)
+			res = make([]byte, len(v))
+			// 'v' is only valid for the life of the transaction
+			copy(res, v)
+			return nil
+		})
 	})
-	return res, nil
+	return res, err
 }
 
 func (r *Repo) SetMetadata(key []byte, value []byte) error {
-	if err := r.open(); err != nil {
-		return err
-	}
-	defer r.close()
 	lg.Debug("bbolt repo: set metadata: %s", string(key))
-	return r.db.Update(func(tx *bbolt.Tx) error {
-		return tx.Bucket(r.metaBucket).Put(key, value)
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(r.metaBucket).Put(key, value)
+		})
 	})
 }
 
 func (r *Repo) TouchEntry(e *entry.Entry) error {
-	if err := r.open(); err != nil {
-		return err
-	}
-	defer r.close()
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(r.entryBucket)
+			var bs []byte
+			if e.ID > 0 {
+				bs = b.Get(itob(e.ID))
+			}
+			if len(bs) == 0 {
+				// insert
+				e.ID, _ = b.NextSequence()
+				lg.Debug("bbolt repo: touch new entry: %d", e.ID)
+				now := time.Now()
+				e.VisitCount = 1
+				e.CreateAt = now
+				e.UpdateAt = now
+			} else {
+				var rawEntry = &entry.Entry{}
+				if err := json.Unmarshal(bs, rawEntry); err != nil {
+					return err
+				}
+				e.ID = rawEntry.ID
+				lg.Debug("bbolt repo: update entry: %d", e.ID)
+				e.VisitCount = rawEntry.VisitCount + 1
+				e.CreateAt = rawEntry.CreateAt
+				e.UpdateAt = time.Now()
+			}
+			// update
+			buf, encodeErr := encodeEntry(e)
+			if encodeErr != nil {
+				return encodeErr
+			}
+			return b.Put(itob(e.ID), buf)
+		})
+	})
+}
 
-	return r.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(r.entryBucket)
-		var bs []byte
-		if e.ID > 0 {
-			bs = b.Get(itob(e.ID))
-		}
-		if len(bs) == 0 {
-			// insert
-			e.ID, _ = b.NextSequence()
-			lg.Debug("bbolt repo: touch new entry: %d", e.ID)
-			now := time.Now()
-			e.VisitCount = 1
-			e.CreateAt = now
-			e.UpdateAt = now
-		} else {
-			var rawEntry = &entry.Entry{}
-			if err := json.Unmarshal(bs, rawEntry); err != nil {
+// SaveEntry saves the changes of a stored entry, unlike TouchEntry
+// it is not counted as a visit
+func (r *Repo) SaveEntry(e *entry.Entry) error {
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(r.entryBucket)
+			if e.ID == 0 || len(b.Get(itob(e.ID))) == 0 {
+				return errmsg.ErrEntryNotExist
+			}
+			lg.Debug("bbolt repo: save entry: %d", e.ID)
+			buf, err := encodeEntry(e)
+			if err != nil {
 				return err
 			}
-			e.ID = rawEntry.ID
-			lg.Debug("bbolt repo: update entry: %d", e.ID)
-			e.VisitCount = rawEntry.VisitCount + 1
-			e.CreateAt = rawEntry.CreateAt
-			e.UpdateAt = time.Now()
-		}
-		// update
-		buf, encodeErr := encodeEntry(e)
-		if encodeErr != nil {
-			return encodeErr
-		}
-		return b.Put(itob(e.ID), buf)
+			return b.Put(itob(e.ID), buf)
+		})
 	})
 }
 
 func (r *Repo) GetEntry(id uint64) (e *entry.Entry, err error) {
-	if err = r.open(); err != nil {
-		return
-	}
-	defer r.close()
-
 	lg.Debug("bbolt repo: get entry by id: %d", id)
-	err = r.db.View(func(tx *bbolt.Tx) error {
-		bs := tx.Bucket(r.entryBucket).Get(itob(id))
-		if len(bs) == 0 {
-			return errmsg.ErrEntryNotExist
-		}
-		var decodeErr error
-		e, decodeErr = decodeEntry(bs)
-		if decodeErr != nil {
-			return decodeErr
-		}
-		return nil
+	err = r.withDB(func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			bs := tx.Bucket(r.entryBucket).Get(itob(id))
+			if len(bs) == 0 {
+				return errmsg.ErrEntryNotExist
+			}
+			var decodeErr error
+			e, decodeErr = decodeEntry(bs)
+			if decodeErr != nil {
+				return decodeErr
+			}
+			return nil
+		})
 	})
 	return
 }
 
 // GetAllEntries returns all entries map, key format is "ip/user"
 func (r *Repo) GetAllEntries() (map[uint64]*entry.Entry, error) {
-	if err := r.open(); err != nil {
-		return nil, err
-	}
-	defer r.close()
-
 	var (
 		err error
 		m   = map[uint64]*entry.Entry{}
 	)
 
 	lg.Debug("bbolt repo: get all enrties")
-	err = r.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(r.entryBucket)
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			e, decodeErr := decodeEntry(v)
-			if decodeErr != nil {
-				return decodeErr
+	err = r.withDB(func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(r.entryBucket)
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				e, decodeErr := decodeEntry(v)
+				if decodeErr != nil {
+					return decodeErr
+				}
+				m[e.ID] = e
 			}
-			m[e.ID] = e
-		}
-		return nil
+			return nil
+		})
 	})
 	return m, err
 }
 
 func (r *Repo) DeleteEntry(id uint64) error {
-	if err := r.open(); err != nil {
-		return err
-	}
-	defer r.close()
-
 	lg.Debug("bbolt repo: delete entry: %d", id)
-	return r.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(r.entryBucket)
-		return b.Delete(itob(id))
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(r.entryBucket)
+			return b.Delete(itob(id))
+		})
 	})
 }
 
-func (r *Repo) Init() error {
-	if err := r.open(); err != nil {
-		return err
-	}
-	defer r.close()
-	return r.db.Update(func(tx *bbolt.Tx) error {
-		for _, bucketName := range r.buckets() {
-			_, createErr := tx.CreateBucketIfNotExists(bucketName)
-			if createErr != nil {
-				return createErr
+// AddHistory saves a new connection record, its ID is assigned.
+// The oldest records are deleted to keep at most limit ones if limit is positive.
+func (r *Repo) AddHistory(h *history.Record, limit int) error {
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(r.historyBucket)
+			h.ID, _ = b.NextSequence()
+			lg.Debug("bbolt repo: add history: %d", h.ID)
+			buf, err := json.Marshal(h)
+			if err != nil {
+				return err
 			}
-		}
-		return nil
+			if err = b.Put(itob(h.ID), buf); err != nil {
+				return err
+			}
+			if limit <= 0 || h.ID <= uint64(limit) {
+				return nil
+			}
+			// IDs are increasing, the ones not greater than it are out of limit
+			oldest := h.ID - uint64(limit)
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= oldest; k, _ = c.First() {
+				if err = c.Delete(); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	})
 }
 
-func (r *Repo) close() error {
-	if r.db == nil {
-		return nil
-	}
-	err := r.db.Close()
-	if err == nil {
-		r.db = nil
-	}
-	return err
+// GetAllHistory returns all connection records in the order of ID
+func (r *Repo) GetAllHistory() ([]*history.Record, error) {
+	var records []*history.Record
+	lg.Debug("bbolt repo: get all history")
+	err := r.withDB(func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			return tx.Bucket(r.historyBucket).ForEach(func(k, v []byte) error {
+				h := &history.Record{}
+				if err := json.Unmarshal(v, h); err != nil {
+					return err
+				}
+				records = append(records, h)
+				return nil
+			})
+		})
+	})
+	return records, err
+}
+
+// SaveSnippet inserts or updates the snippet, ID of new snippet is assigned
+func (r *Repo) SaveSnippet(sn *snippet.Snippet) error {
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(r.snippetBucket)
+			if sn.ID == 0 {
+				sn.ID, _ = b.NextSequence()
+			}
+			lg.Debug("bbolt repo: save snippet: %d", sn.ID)
+			buf, err := json.Marshal(sn)
+			if err != nil {
+				return err
+			}
+			return b.Put(itob(sn.ID), buf)
+		})
+	})
 }
 
-func (r *Repo) open() error {
+// GetAllSnippets returns all snippets in the order of ID
+func (r *Repo) GetAllSnippets() ([]*snippet.Snippet, error) {
+	var snippets []*snippet.Snippet
+	lg.Debug("bbolt repo: get all snippets")
+	err := r.withDB(func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			return tx.Bucket(r.snippetBucket).ForEach(func(k, v []byte) error {
+				sn := &snippet.Snippet{}
+				if err := json.Unmarshal(v, sn); err != nil {
+					return err
+				}
+				snippets = append(snippets, sn)
+				return nil
+			})
+		})
+	})
+	return snippets, err
+}
+
+func (r *Repo) DeleteSnippet(id uint64) error {
+	lg.Debug("bbolt repo: delete snippet: %d", id)
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(r.snippetBucket).Delete(itob(id))
+		})
+	})
+}
+
+func (r *Repo) Init() error {
+	return r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			for _, bucketName := range r.buckets() {
+				_, createErr := tx.CreateBucketIfNotExists(bucketName)
+				if createErr != nil {
+					return createErr
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// withDB opens the db file, calls fn with it and closes it. The file is not kept
+// open between operations, and the repo is shared by goroutines, e.g. 'ssx run',
+// so the operations are serialized.
+func (r *Repo) withDB(fn func(db *bbolt.DB) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	db, err := bbolt.Open(r.file, 0600, nil)
 	if err != nil {
 		return err
 	}
-	r.db = db
-	return nil
+	defer db.Close()
+	return fn(db)
 }
 
 func (r *Repo) buckets() [][]byte {
-	return [][]byte{r.metaBucket, r.entryBucket}
+	return [][]byte{r.metaBucket, r.entryBucket, r.historyBucket, r.snippetBucket}
 }
 
 func NewRepo(file string) *Repo {
 	lg.Debug("new repo with %q", file)
 	return &Repo{
-		file:        file,
-		metaBucket:  []byte("metadata"),
-		entryBucket: []byte("entries"),
+		file:          file,
+		metaBucket:    []byte("metadata"),
+		entryBucket:   []byte("entries"),
+		historyBucket: []byte("history"),
+		snippetBucket: []byte("snippets"),
 	}
 }
 
 func encodeEntry(e *entry.Entry) ([]byte, error) {
+	// encrypt a copy, the caller keeps using the plain secrets
+	e, err := e.Copy()
+	if err != nil {
+		return nil, err
+	}
 	e.Password = encrypt.Encrypt(e.Password)
 	e.Passphrase = encrypt.Encrypt(e.Passphrase)
+	e.TOTPSecret = encrypt.Encrypt(e.TOTPSecret)
+	for p := e.Proxy; p != nil; p = p.Proxy {
+		p.Password = encrypt.Encrypt(p.Password)
+		p.Passphrase = encrypt.Encrypt(p.Passphrase)
+		p.TOTPSecret = encrypt.Encrypt(p.TOTPSecret)
+	}
 	return json.Marshal(e)
 }
 
@@ -220,5 +329,15 @@ func decodeEntry(bs []byte) (*entry.Entry, error) {
 	}
 	e.Password = encrypt.Decrypt(e.Password)
 	e.Passphrase = encrypt.Decrypt(e.Passphrase)
+	e.TOTPSecret = encrypt.Decrypt(e.TOTPSecret)
+	for p := e.Proxy; p != nil; p = p.Proxy {
+		// the password of jump server was stored in plain text by earlier versions,
+		// such one is kept as is and encrypted when the entry is saved next time
+		if encrypt.IsEncrypted(p.Password) {
+			p.Password = encrypt.Decrypt(p.Password)
+		}
+		p.Passphrase = encrypt.Decrypt(p.Passphrase)
+		p.TOTPSecret = encrypt.Decrypt(p.TOTPSecret)
+	}
 	return e, nil
 }
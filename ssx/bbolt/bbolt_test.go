@@ -0,0 +1,179 @@
+package bbolt
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+
+	"github.com/vimiix/ssx/internal/errmsg"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/history"
+)
+
+func newTestRepo(t *testing.T) *Repo {
+	r := NewRepo(filepath.Join(t.TempDir(), "ssx.db"))
+	if err := r.Init(); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	return r
+}
+
+func TestRepo_Concurrent(t *testing.T) {
+	r := newTestRepo(t)
+	var entries []*entry.Entry
+	for i := 0; i < 8; i++ {
+		e := &entry.Entry{Host: "10.0.0.1", Port: "22", User: "root"}
+		if err := r.TouchEntry(e); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		entries = append(entries, e)
+	}
+
+	// like 'ssx run', entries are touched and read by goroutines at once
+	var wg sync.WaitGroup
+	errs := make(chan error, len(entries)*2)
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry.Entry) {
+			defer wg.Done()
+			errs <- r.TouchEntry(e)
+			_, err := r.GetEntry(e.ID)
+			errs <- err
+		}(e)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	all, err := r.GetAllEntries()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Len(t, all, len(entries))
+	for _, e := range all {
+		assert.Equal(t, 2, e.VisitCount)
+	}
+}
+
+func TestRepo_PlainProxyPassword(t *testing.T) {
+	r := newTestRepo(t)
+	// jump server passwords were stored in plain text by earlier versions
+	raw := `{"id":1,"host":"10.0.0.1","port":"22","user":"root",` +
+		`"proxy":{"host":"10.0.0.2","password":"abcd1234","proxy":{"host":"10.0.0.3","password":"aGVsbG8gd29ybGQgaGVsbG8gd29ybGQ="}}}`
+	err := r.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(r.entryBucket).Put(itob(1), []byte(raw))
+		})
+	})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	e, err := r.GetEntry(1)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "abcd1234", e.Proxy.Password)
+	assert.Equal(t, "aGVsbG8gd29ybGQgaGVsbG8gd29ybGQ=", e.Proxy.Proxy.Password)
+
+	// encrypted once saved again
+	if err = r.TouchEntry(e); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	var stored []byte
+	err = r.withDB(func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			stored = append(stored, tx.Bucket(r.entryBucket).Get(itob(1))...)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.NotContains(t, string(stored), "abcd1234")
+	e, err = r.GetEntry(1)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "abcd1234", e.Proxy.Password)
+	assert.Equal(t, "aGVsbG8gd29ybGQgaGVsbG8gd29ybGQ=", e.Proxy.Proxy.Password)
+}
+
+func TestRepo_History(t *testing.T) {
+	r := newTestRepo(t)
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		h := &history.Record{
+			EntryID: uint64(i%2 + 1),
+			Address: "root@10.0.0.1:22",
+			Mode:    history.ModeExec,
+			Command: "uptime",
+			Start:   start.Add(time.Duration(i) * time.Minute),
+			End:     start.Add(time.Duration(i)*time.Minute + time.Second),
+		}
+		if err := r.AddHistory(h, 0); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		assert.Equal(t, uint64(i+1), h.ID)
+	}
+
+	records, err := r.GetAllHistory()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if assert.Len(t, records, 5) {
+		assert.Equal(t, uint64(1), records[0].ID)
+		assert.Equal(t, uint64(5), records[4].ID)
+		assert.Equal(t, "uptime", records[4].Command)
+		assert.Equal(t, time.Second, records[4].Duration())
+		assert.True(t, start.Add(4*time.Minute).Equal(records[4].Start))
+	}
+
+	// the oldest ones beyond limit are deleted
+	if err = r.AddHistory(&history.Record{Mode: history.ModeInteractive}, 3); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	records, err = r.GetAllHistory()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	var ids []uint64
+	for _, h := range records {
+		ids = append(ids, h.ID)
+	}
+	assert.Equal(t, []uint64{4, 5, 6}, ids)
+}
+
+func TestRepo_SaveEntry(t *testing.T) {
+	r := newTestRepo(t)
+	e := &entry.Entry{Host: "10.0.0.1", Port: "22", User: "root"}
+	if err := r.TouchEntry(e); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	stored, err := r.GetEntry(e.ID)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	stored.Tags = []string{"web"}
+	if err = r.SaveEntry(stored); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	saved, err := r.GetEntry(e.ID)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, []string{"web"}, saved.Tags)
+	// not counted as a visit
+	assert.Equal(t, 1, saved.VisitCount)
+	assert.True(t, e.UpdateAt.Equal(saved.UpdateAt))
+
+	assert.ErrorIs(t, r.SaveEntry(&entry.Entry{ID: 100, Host: "10.0.0.2"}), errmsg.ErrEntryNotExist)
+	assert.ErrorIs(t, r.SaveEntry(&entry.Entry{Host: "10.0.0.2"}), errmsg.ErrEntryNotExist)
+}
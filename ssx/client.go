@@ -2,13 +2,17 @@ package ssx
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/containerd/console"
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/vimiix/ssx/internal/lg"
@@ -23,8 +27,16 @@ const (
 type Client struct {
 	repo      Repo
 	entry     *entry.Entry
+	mu        sync.Mutex // guards cli replaced on reconnect, which is read by forwards
 	cli       *ssh.Client
 	closeOnce *sync.Once
+	dialMux   func(ctx context.Context) (*ssh.Client, error) // connects through mux master if set
+	record    bool                                           // record interactive session into asciicast file
+
+	startupCommand string      // run instead of login shell in interactive session if set
+	autoReconnect  bool        // reconnect interactive session if connection lost
+	lost           atomic.Bool // connection is closed by keepalive for no response
+	remoteForwards []*Forward  // requested again once reconnected
 }
 
 func NewClient(e *entry.Entry, repo Repo) *Client {
@@ -43,21 +55,35 @@ func (c *Client) touchEntry(e *entry.Entry) error {
 }
 
 type ExecuteOption struct {
-	Command string
+	Command string // login shell is started if empty
+	Stdin   io.Reader
 	Stdout  io.Writer
 	Stderr  io.Writer
 	Timeout time.Duration
+	TTY     bool // allocate a pseudo terminal for the command
+
+	// TimeoutSignal is sent to the command once timed out, SIGTERM if empty,
+	// and the session is closed if it is still running after GracePeriod
+	TimeoutSignal ssh.Signal
+	GracePeriod   time.Duration
 }
 
-// Execute a command combined stdout and stderr output, then exit
-func (c *Client) Execute(ctx context.Context, opt *ExecuteOption) error {
+// Execute a command combined stdout and stderr output, then exit,
+// stdin is forwarded to the command until EOF if specified.
+// The received signal or TimeoutSignal is sent to the command if ctx is done.
+func (c *Client) Execute(ctx context.Context, opt *ExecuteOption) (err error) {
 	if opt.Timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
 		defer cancel()
+		defer func() {
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = &timeoutError{timeout: opt.Timeout, err: err}
+			}
+		}()
 	}
 
-	if err := c.Login(ctx); err != nil {
+	if err = c.Login(ctx); err != nil {
 		return err
 	}
 	defer c.close()
@@ -68,18 +94,77 @@ func (c *Client) Execute(ctx context.Context, opt *ExecuteOption) error {
 	}
 	defer sess.Close()
 
+	c.setEnv(sess)
+	if opt.TTY {
+		reset, err := requestPty(ctx, sess, nil)
+		if err != nil {
+			return err
+		}
+		defer reset()
+	}
+	if opt.Stdin != nil {
+		// not assigned to sess.Stdin, otherwise Wait blocks until stdin is closed
+		stdinPipe, err := sess.StdinPipe()
+		if err != nil {
+			return err
+		}
+		go func() {
+			ioCopy(stdinPipe, opt.Stdin)
+			_ = stdinPipe.Close()
+		}()
+	}
 	sess.Stdout = opt.Stdout
 	sess.Stderr = opt.Stderr
-	return sess.Run(opt.Command)
+	if opt.Command == "" {
+		err = sess.Shell()
+	} else {
+		err = sess.Start(opt.Command)
+	}
+	if err != nil {
+		return err
+	}
+	c.startKeepalive(ctx)
+	stop := terminateOnDone(ctx, sess, opt.TimeoutSignal, opt.GracePeriod)
+	defer stop()
+	return waitSession(ctx, sess)
 }
 
-// Interact Bind the current terminal to provide an interactive interface
+// waitSession waits the remote process of sess to exit, ctx is returned
+// as the cause if the session was closed before that
+func waitSession(ctx context.Context, sess *ssh.Session) error {
+	err := sess.Wait()
+	if err != nil && ctx.Err() != nil && !IsRemoteExit(err) {
+		return errors.Wrap(context.Cause(ctx), "session closed")
+	}
+	return err
+}
+
+// Interact Bind the current terminal to provide an interactive interface,
+// a new shell is started if connection lost and auto reconnect is enabled
 func (c *Client) Interact(ctx context.Context) error {
 	if err := c.Login(ctx); err != nil {
 		return err
 	}
 	defer c.close()
 
+	for {
+		err := c.interact(ctx)
+		if !c.connectionLost(ctx, err) {
+			return err
+		}
+		lg.Error("connection to %s lost", c.entry.String())
+		if !c.autoReconnect {
+			lg.Info("use --reconnect to reconnect automatically when connection lost")
+			return &connectError{err: errors.Errorf("connection to %s lost", c.entry.String())}
+		}
+		if err = c.reconnect(ctx); err != nil {
+			return &connectError{err: err}
+		}
+		lg.Warn("reconnected, the previous shell and its processes are lost")
+	}
+}
+
+func (c *Client) interact(ctx context.Context) error {
 	lg.Info("connected server %s, version: %s",
 		c.entry.String(), string(c.cli.ServerVersion()))
 	session, err := c.cli.NewSession()
@@ -94,28 +179,24 @@ func (c *Client) Interact(ctx context.Context) error {
 }
 
 func (c *Client) attach(ctx context.Context, sess *ssh.Session) error {
-	current := console.Current()
-	defer func() {
-		_ = current.Reset()
-	}()
-
-	if err := current.SetRaw(); err != nil {
-		return err
+	c.setEnv(sess)
+	var rec *recorder
+	if c.record {
+		var err error
+		if rec, err = newRecorder(c.entry); err != nil {
+			lg.Warn("%s, the session is not recorded", err)
+		} else {
+			defer rec.close()
+		}
 	}
-
-	w, h, err := terminal.GetAndWatchWindowSize(ctx, sess)
+	reset, err := requestPty(ctx, sess, rec)
 	if err != nil {
+		if rec != nil {
+			rec.discard()
+		}
 		return err
 	}
-
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,     // enable echoing
-		ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
-		ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
-	}
-	if err = sess.RequestPty("xterm", h, w, modes); err != nil {
-		return err
-	}
+	defer reset()
 
 	var closeStdin sync.Once
 	stdinPipe, err := sess.StdinPipe()
@@ -127,60 +208,176 @@ func (c *Client) attach(ctx context.Context, sess *ssh.Session) error {
 	})
 	sess.Stdout = os.Stdout
 	sess.Stderr = os.Stderr
+	if rec != nil {
+		// stderr is merged into stdout by pty
+		sess.Stdout = io.MultiWriter(os.Stdout, rec)
+	}
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
 		defer closeStdin.Do(func() {
 			_ = stdinPipe.Close()
 		})
-		ioCopy(stdinPipe, os.Stdin)
+		for {
+			select {
+			case b, ok := <-sharedStdin():
+				if !ok {
+					return
+				}
+				if _, err := stdinPipe.Write(b); err != nil {
+					lg.Debug("failed to write stdin: %s", err)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
 	}()
 
-	if err = sess.Shell(); err != nil {
+	if c.startupCommand != "" {
+		lg.Info("running startup command: %s", c.startupCommand)
+		err = sess.Start(c.startupCommand)
+	} else {
+		err = sess.Shell()
+	}
+	if err != nil {
 		return err
 	}
 
-	go c.keepalive(ctx)
+	c.startKeepalive(ctx)
 
-	_ = sess.Wait() // ignore *ExitError, always exit with code 130
-	return nil
+	stop := terminateOnDone(ctx, sess, ssh.SIGHUP, defaultGracePeriod)
+	defer stop()
+	// exit status of the login shell is passed to caller
+	return waitSession(ctx, sess)
 }
 
-func ioCopy(dst io.Writer, src io.Reader) {
-	if _, err := io.Copy(dst, src); err != nil {
-		lg.Error(err.Error())
+// setEnv sends environment variables of entry to sess, variables
+// rejected by server (see AcceptEnv of sshd) are skipped
+func (c *Client) setEnv(sess *ssh.Session) {
+	for _, kv := range c.entry.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if err := sess.Setenv(name, value); err != nil {
+			lg.Warn("failed to set environment variable %s, please check AcceptEnv of sshd: %s", name, err)
+		}
 	}
 }
 
-func (c *Client) keepalive(ctx context.Context) {
-	ticker := time.NewTicker(time.Second * 10)
-	for {
-		select {
-		case <-ticker.C:
-		case <-ctx.Done():
-			ticker.Stop()
-			return
+// requestPty allocates a pseudo terminal for sess with the size of local terminal,
+// local terminal is set to raw mode until reset is called.
+// The size and its changes are recorded by rec if not nil.
+func requestPty(ctx context.Context, sess *ssh.Session, rec *recorder) (reset func(), err error) {
+	reset = func() {}
+	w, h := 80, 24
+	var wc terminal.WindowChanger = sess
+	if rec != nil {
+		wc = &recordedSession{Session: sess, rec: rec}
+	}
+	if terminal.IsTerminal(os.Stdin) {
+		current := console.Current()
+		if err = current.SetRaw(); err != nil {
+			return nil, err
 		}
-		_, _, err := c.cli.SendRequest("keepalive@openssh.com", false, nil)
+		reset = func() {
+			_ = current.Reset()
+		}
+		w, h, err = terminal.GetAndWatchWindowSize(ctx, wc)
 		if err != nil {
-			break
+			reset()
+			return nil, err
 		}
 	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,     // enable echoing
+		ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
+		ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
+	}
+	if err = sess.RequestPty("xterm", h, w, modes); err != nil {
+		reset()
+		return nil, err
+	}
+	if rec != nil {
+		if err := rec.start(w, h); err != nil {
+			lg.Warn("%s, the session is not recorded", err)
+			rec.discard()
+		}
+	}
+	return reset, nil
+}
+
+func ioCopy(dst io.Writer, src io.Reader) {
+	if _, err := io.Copy(dst, src); err != nil {
+		lg.Error(err.Error())
+	}
 }
 
 // code source: https://github.com/golang/go/issues/20288#issuecomment-832033017
-func dialContext(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+// dialContext connects addr directly, name is the hop shown in errors
+func dialContext(ctx context.Context, name, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
 	d := net.Dialer{Timeout: config.Timeout}
 	conn, err := d.DialContext(ctx, NETWORK, addr)
 	if err != nil {
 		return nil, err
 	}
-	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	return newClientConn(conn, name, addr, config)
+}
+
+// ErrAuthentication is wrapped by the errors of failed authentication
+var ErrAuthentication = errors.New("authentication failed")
+
+// authError marks the handshake error of a hop as ErrAuthentication
+type authError struct {
+	host string
+	err  error
+}
+
+func (e *authError) Error() string {
+	return fmt.Sprintf("failed to login %s: %s", e.host, e.err)
+}
+
+func (e *authError) Unwrap() []error {
+	return []error{ErrAuthentication, e.err}
+}
+
+// newClientConn establishes the ssh connection of hop name over conn.
+// The handshake failed after the host key was accepted is an authentication
+// failure, unless the connection itself was broken.
+func newClientConn(conn net.Conn, name, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var (
+		hostKeyAccepted atomic.Bool
+		cfg             = *config
+	)
+	if config.HostKeyCallback != nil {
+		cfg.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if err := config.HostKeyCallback(hostname, remote, key); err != nil {
+				return err
+			}
+			hostKeyAccepted.Store(true)
+			return nil
+		}
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &cfg)
 	if err != nil {
+		if hostKeyAccepted.Load() && !isTransportError(err) {
+			return nil, &authError{host: name, err: err}
+		}
 		return nil, err
 	}
 	return ssh.NewClient(c, chans, reqs), nil
 }
 
-func dialThroughProxy(ctx context.Context, proxy *entry.Proxy, parentProxyCli *ssh.Client, targetEntry *entry.Entry) (*ssh.Client, error) {
+// isTransportError reports whether err is caused by the broken connection
+func isTransportError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
+
+// sshConfigFunc generates the ssh client config of the target host
+type sshConfigFunc func(ctx context.Context) (*ssh.ClientConfig, error)
+
+func dialThroughProxy(ctx context.Context, proxy *entry.Proxy, parentProxyCli *ssh.Client, targetEntry *entry.Entry, genTargetConfig sshConfigFunc) (*ssh.Client, error) {
 	var err error
 	if parentProxyCli == nil {
 		proxyConfig, err := proxy.GenSSHConfig(ctx)
@@ -188,7 +385,7 @@ func dialThroughProxy(ctx context.Context, proxy *entry.Proxy, parentProxyCli *s
 			return nil, err
 		}
 		lg.Debug("dialing proxy: %s", proxy.String())
-		parentProxyCli, err = dialContext(ctx, proxy.Address(), proxyConfig)
+		parentProxyCli, err = dialContext(ctx, proxy.String(), proxy.Address(), proxyConfig)
 		if err != nil {
 			lg.Debug("dial proxy %s failed: %v", proxy.String(), err)
 			return nil, err
@@ -206,53 +403,85 @@ func dialThroughProxy(ctx context.Context, proxy *entry.Proxy, parentProxyCli *s
 		tmpTargetAddr = proxy.Proxy.Address()
 		tmpTargetConfig, err = proxy.Proxy.GenSSHConfig(ctx)
 		if err != nil {
+			_ = parentProxyCli.Close()
 			return nil, err
 		}
 	} else {
 		tmpHostString = targetEntry.String()
 		tmpTargetAddr = targetEntry.Address()
-		tmpTargetConfig, err = targetEntry.GenSSHConfig(ctx)
+		tmpTargetConfig, err = genTargetConfig(ctx)
 		if err != nil {
+			_ = parentProxyCli.Close()
 			return nil, err
 		}
 	}
 	lg.Debug("dialing to %s", tmpHostString)
 	conn, err := parentProxyCli.DialContext(ctx, NETWORK, tmpTargetAddr)
 	if err != nil {
+		_ = parentProxyCli.Close()
 		return nil, err
 	}
-	nc, chans, reqs, err := ssh.NewClientConn(conn, tmpTargetAddr, tmpTargetConfig)
+	targetCli, err := newClientConn(conn, tmpHostString, tmpTargetAddr, tmpTargetConfig)
 	if err != nil {
+		_ = parentProxyCli.Close()
 		return nil, err
 	}
-	targetCli := ssh.NewClient(nc, chans, reqs)
+	// the jump server connection is useless once the next hop is closed
+	go func(parent *ssh.Client) {
+		_ = targetCli.Wait()
+		_ = parent.Close()
+	}(parentProxyCli)
 	if proxy.Proxy == nil {
 		return targetCli, nil
 	}
-	return dialThroughProxy(ctx, proxy.Proxy, parentProxyCli, targetEntry)
+	return dialThroughProxy(ctx, proxy.Proxy, targetCli, targetEntry, genTargetConfig)
 }
 
-// Login connect remote server and touch enrty in storage
+// Login connect remote server and touch enrty in storage,
+// the established connection is reused if already logged in
 func (c *Client) Login(ctx context.Context) error {
+	if c.cli != nil {
+		return nil
+	}
+	var (
+		cli *ssh.Client
+		err error
+	)
+	if c.dialMux != nil {
+		cli, err = c.dialMux(ctx)
+		if err != nil {
+			lg.Warn("connection multiplexing not available, connect directly: %s", err)
+		} else {
+			lg.Debug("connected %s through mux master", c.entry.String())
+		}
+	}
+	if cli == nil {
+		cli, err = c.connect(ctx)
+		if err != nil {
+			return &connectError{err: err}
+		}
+	}
+	c.setClient(cli)
+	if err := c.touchEntry(c.entry); err != nil {
+		lg.Error("failed to touch entry: %s", err)
+	}
+	return nil
+}
+
+// connect dials the entry, login with interactive authentication
+// again if the stored one failed
+func (c *Client) connect(ctx context.Context) (*ssh.Client, error) {
 	lg.Debug("connecting to %s", c.entry.String())
 	cli, err := c.dial(ctx)
 	if err != nil {
 		// try fix authentication
 		if c.entry.ID != 0 {
 			lg.Error("login failed with stored authentication, try login with interactive")
-			cli, err = c.tryLoginAgainWithEmptyPassword(ctx)
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
+			return c.tryLoginAgainWithEmptyPassword(ctx)
 		}
+		return nil, err
 	}
-	c.cli = cli
-	if err := c.touchEntry(c.entry); err != nil {
-		lg.Error("failed to touch entry: %s", err)
-	}
-	return nil
+	return cli, nil
 }
 
 func (c *Client) tryLoginAgainWithEmptyPassword(ctx context.Context) (*ssh.Client, error) {
@@ -261,15 +490,53 @@ func (c *Client) tryLoginAgainWithEmptyPassword(ctx context.Context) (*ssh.Clien
 }
 
 func (c *Client) dial(ctx context.Context) (*ssh.Client, error) {
+	return c.dialWith(ctx, c.entry.GenSSHConfig)
+}
+
+// dialWith connects the entry through its jump servers if any,
+// the config of the entry itself is generated by genConfig
+func (c *Client) dialWith(ctx context.Context, genConfig sshConfigFunc) (*ssh.Client, error) {
 	if c.entry.Proxy != nil {
-		return dialThroughProxy(ctx, c.entry.Proxy, nil, c.entry)
+		return dialThroughProxy(ctx, c.entry.Proxy, nil, c.entry, genConfig)
 	}
 	// connect directly
-	sshConfig, err := c.entry.GenSSHConfig(ctx)
+	sshConfig, err := genConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return dialContext(ctx, c.entry.Address(), sshConfig)
+	return dialContext(ctx, c.entry.String(), c.entry.Address(), sshConfig)
+}
+
+var errHostKeyScanned = errors.New("host key scanned")
+
+// ScanHostKey fetches the host key of entry without authentication,
+// jump servers are still verified and authenticated as usual
+func (c *Client) ScanHostKey(ctx context.Context) (ssh.PublicKey, net.Addr, error) {
+	var (
+		hostKey    ssh.PublicKey
+		remoteAddr net.Addr
+	)
+	genConfig := func(ctx context.Context) (*ssh.ClientConfig, error) {
+		return &ssh.ClientConfig{
+			User: c.entry.User,
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				hostKey, remoteAddr = key, remote
+				return errHostKeyScanned
+			},
+			Timeout: entry.ConnectTimeout(),
+		}, nil
+	}
+	cli, err := c.dialWith(ctx, genConfig)
+	if cli != nil {
+		_ = cli.Close()
+	}
+	if hostKey != nil {
+		return hostKey, remoteAddr, nil
+	}
+	if err == nil {
+		err = errors.New("no host key received")
+	}
+	return nil, nil, err
 }
 
 func (c *Client) close() {
@@ -278,6 +545,12 @@ func (c *Client) close() {
 	}
 	c.closeOnce.Do(func() {
 		_ = c.cli.Close()
-		c.cli = nil
+		c.setClient(nil)
 	})
 }
+
+func (c *Client) setClient(cli *ssh.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cli = cli
+}
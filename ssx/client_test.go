@@ -0,0 +1,367 @@
+package ssx
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/terminal"
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+// testServer is a ssh server which accepts password "secret", forwards
+// direct-tcpip channels like a jump server and serves tcpip-forward requests
+type testServer struct {
+	host, port string
+	// exec runs command of user in session channels if set, and returns
+	// the exit status, the session is closed without exit status if negative
+	exec      func(user, command string, stdout io.Writer) int
+	mu        sync.Mutex
+	dialed    []string // addresses of direct-tcpip channels
+	conns     []*ssh.ServerConn
+	closeOnce sync.Once
+	closed    chan struct{} // closed once the first client connection is gone
+}
+
+func startTestServer(t *testing.T) *testServer {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	s := &testServer{closed: make(chan struct{})}
+	s.host, s.port, _ = net.SplitHostPort(ln.Addr().String())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.conns = append(s.conns, sconn)
+	s.mu.Unlock()
+	go func() {
+		_ = sconn.Wait()
+		s.closeOnce.Do(func() { close(s.closed) })
+	}()
+	go func() {
+		// listeners are gone along with the connection
+		var listeners []net.Listener
+		defer func() {
+			for _, ln := range listeners {
+				_ = ln.Close()
+			}
+		}()
+		for req := range reqs {
+			if req.Type != "tcpip-forward" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			ln, err := s.listen(sconn, req.Payload)
+			if err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			listeners = append(listeners, ln)
+			port := ln.Addr().(*net.TCPAddr).Port
+			_ = req.Reply(true, ssh.Marshal(struct{ Port uint32 }{uint32(port)}))
+		}
+	}()
+	for nc := range chans {
+		if nc.ChannelType() == "session" && s.exec != nil {
+			go s.session(sconn.User(), nc)
+			continue
+		}
+		go s.forward(nc)
+	}
+}
+
+// session serves an exec request by s.exec, other requests are refused
+func (s *testServer) session(user string, nc ssh.NewChannel) {
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err = ssh.Unmarshal(req.Payload, &payload); err != nil {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+		status := s.exec(user, payload.Command, ch)
+		if status >= 0 {
+			_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+		}
+		return
+	}
+}
+
+// listen serves a tcpip-forward request, connections accepted
+// are sent back to the client as forwarded-tcpip channels
+func (s *testServer) listen(sconn *ssh.ServerConn, payload []byte) (net.Listener, error) {
+	var req struct {
+		Addr string
+		Port uint32
+	}
+	if err := ssh.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(req.Addr, strconv.Itoa(int(req.Port))))
+	if err != nil {
+		return nil, err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			origin := conn.RemoteAddr().(*net.TCPAddr)
+			ch, reqs, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+				Addr       string
+				Port       uint32
+				OriginAddr string
+				OriginPort uint32
+			}{req.Addr, uint32(port), origin.IP.String(), uint32(origin.Port)}))
+			if err != nil {
+				_ = conn.Close()
+				continue
+			}
+			go ssh.DiscardRequests(reqs)
+			go pipe(ch, conn)
+		}
+	}()
+	return ln, nil
+}
+
+// disconnect closes all client connections like a network failure
+func (s *testServer) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) addr() string {
+	return net.JoinHostPort(s.host, s.port)
+}
+
+func (s *testServer) dialedAddrs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.dialed...)
+}
+
+func (s *testServer) forward(nc ssh.NewChannel) {
+	if nc.ChannelType() != "direct-tcpip" {
+		_ = nc.Reject(ssh.UnknownChannelType, "not supported")
+		return
+	}
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(nc.ExtraData(), &payload); err != nil {
+		_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+	s.mu.Lock()
+	s.dialed = append(s.dialed, addr)
+	s.mu.Unlock()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn)
+}
+
+// pipe copies data between ch and conn until both directions are done
+func pipe(ch ssh.Channel, conn net.Conn) {
+	go func() {
+		_, _ = io.Copy(ch, conn)
+		_ = ch.CloseWrite()
+	}()
+	_, _ = io.Copy(conn, ch)
+	_ = conn.Close()
+}
+
+func testProxy(s *testServer, next *entry.Proxy) *entry.Proxy {
+	return &entry.Proxy{
+		Host:          s.host,
+		Port:          s.port,
+		User:          "test",
+		Password:      "secret",
+		DisableAgent:  true,
+		HostKeyPolicy: entry.HostKeyPolicyOff,
+		Proxy:         next,
+	}
+}
+
+func TestDialThroughMultipleProxies(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	target := startTestServer(t)
+	jump2 := startTestServer(t)
+	jump1 := startTestServer(t)
+
+	e := &entry.Entry{
+		Host:          target.host,
+		Port:          target.port,
+		User:          "test",
+		Password:      "secret",
+		DisableAgent:  true,
+		HostKeyPolicy: entry.HostKeyPolicyOff,
+		Proxy:         testProxy(jump1, testProxy(jump2, nil)),
+	}
+	cli, err := NewClient(e, nil).dial(context.Background())
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, []string{jump2.addr()}, jump1.dialedAddrs())
+	assert.Equal(t, []string{target.addr()}, jump2.dialedAddrs())
+	assert.Empty(t, target.dialedAddrs())
+
+	// jump servers are disconnected along with the target
+	_ = cli.Close()
+	for _, s := range []*testServer{jump2, jump1} {
+		select {
+		case <-s.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("connection to jump server %s is not closed", s.addr())
+		}
+	}
+}
+
+func TestDialAuthenticationFailed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	target := startTestServer(t)
+	jump := startTestServer(t)
+
+	wrongTarget := func() *entry.Entry {
+		return &entry.Entry{
+			Host:          target.host,
+			Port:          target.port,
+			User:          "test",
+			Password:      "wrong",
+			DisableAgent:  true,
+			HostKeyPolicy: entry.HostKeyPolicyOff,
+		}
+	}
+	wrongJump := testProxy(jump, nil)
+	wrongJump.Password = "wrong"
+	behindWrongJump := wrongTarget()
+	behindWrongJump.Password = "secret"
+	behindWrongJump.Proxy = wrongJump
+	behindJump := wrongTarget()
+	behindJump.Proxy = testProxy(jump, nil)
+
+	tests := []struct {
+		name  string
+		entry *entry.Entry
+		hop   string
+	}{
+		{"target", wrongTarget(), "test@" + target.addr()},
+		{"jump server", behindWrongJump, wrongJump.String()},
+		{"target behind jump server", behindJump, "test@" + target.addr()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.entry, nil).dial(terminal.DisablePrompt(context.Background()))
+			assert.ErrorIs(t, err, ErrAuthentication)
+			assert.Contains(t, err.Error(), "failed to login "+tt.hop)
+			assert.Equal(t, ExitCodeAuth, ExitCode(&connectError{err: err}))
+		})
+	}
+}
+
+// the connection broken during authentication is not an authentication failure
+func TestDialClosedDuringAuthentication(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		config := &ssh.ServerConfig{
+			PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+				_ = conn.Close()
+				return nil, ssh.ErrNoAuth
+			},
+		}
+		config.AddHostKey(signer)
+		_, _, _, _ = ssh.NewServerConn(conn, config)
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	e := &entry.Entry{
+		Host:          host,
+		Port:          port,
+		User:          "test",
+		Password:      "secret",
+		DisableAgent:  true,
+		HostKeyPolicy: entry.HostKeyPolicyOff,
+	}
+	_, err = NewClient(e, nil).dial(terminal.DisablePrompt(context.Background()))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrAuthentication)
+	assert.Equal(t, ExitCodeConnection, ExitCode(&connectError{err: err}))
+}
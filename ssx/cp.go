@@ -2,20 +2,20 @@ package ssx
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 
-	scp "github.com/bramvdbogaerde/go-scp"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/ssh"
 
 	"github.com/vimiix/ssx/internal/lg"
 	"github.com/vimiix/ssx/internal/utils"
 	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/history"
 )
 
 // CpPath represents a parsed path (local or remote)
@@ -89,17 +89,26 @@ func ParseCpPath(pathStr string) *CpPath {
 
 // CpOption holds options for cp command
 type CpOption struct {
-	Source       string
+	Sources      []string // the target must be a directory if there are several sources
 	Target       string
 	IdentityFile string
 	JumpServers  string
 	Port         int
 	Recursive    bool
+	Protocol     string // sftp by default, or scp
+
+	FollowSymlinks bool // copy targets of symlinks in directories instead of symlinks
+	Quiet          bool // do not report progress
+	Resume         bool // continue from the existing partial file of target
+	Verify         bool // compare SHA-256 checksums after copied
 }
 
 // Copy performs file copy between local and remote, or remote to remote
-func (s *SSX) Copy(ctx context.Context, opt *CpOption) error {
-	srcPath := ParseCpPath(opt.Source)
+func (s *SSX) Copy(ctx context.Context, opt *CpOption) (err error) {
+	srcPath, srcs, err := parseCpSources(opt.Sources)
+	if err != nil {
+		return err
+	}
 	dstPath := ParseCpPath(opt.Target)
 
 	// Local to local: not supported
@@ -109,24 +118,13 @@ func (s *SSX) Copy(ctx context.Context, opt *CpOption) error {
 
 	// Remote to remote: stream transfer through local
 	if srcPath.IsRemote && dstPath.IsRemote {
-		return s.copyRemoteToRemote(ctx, srcPath, dstPath, opt)
+		return s.copyRemoteToRemote(ctx, srcPath, srcs, dstPath, opt)
 	}
 
 	// Local to remote or remote to local
-	var (
-		remotePath *CpPath
-		localPath  string
-		isUpload   bool
-	)
-
+	remotePath := dstPath
 	if srcPath.IsRemote {
 		remotePath = srcPath
-		localPath = dstPath.Path
-		isUpload = false
-	} else {
-		remotePath = dstPath
-		localPath = srcPath.Path
-		isUpload = true
 	}
 
 	// Resolve remote entry
@@ -135,29 +133,75 @@ func (s *SSX) Copy(ctx context.Context, opt *CpOption) error {
 		return errors.Wrap(err, "failed to resolve remote path")
 	}
 	remotePath.Entry = e
+	h := newHistory(e, history.ModeCopy, opt.command())
+	defer func() {
+		s.saveHistory(h, e, err)
+	}()
 
 	// Create SSH client and connect
-	client := NewClient(e, s.repo)
+	client := s.newClient(e)
 	if err := client.Login(ctx); err != nil {
 		return errors.Wrap(err, "failed to connect to remote host")
 	}
 	defer client.close()
 
-	// Create SCP client from existing SSH connection
-	scpClient, err := scp.NewClientBySSH(client.cli)
+	rfs, err := newRemoteFS(ctx, client.cli, opt.Protocol)
 	if err != nil {
-		return errors.Wrap(err, "failed to create SCP client")
+		return err
+	}
+	defer rfs.Close()
+
+	if !srcPath.IsRemote {
+		for i := range srcs {
+			srcs[i] = utils.ExpandHomeDir(srcs[i])
+		}
+		lg.Info("uploading %s -> %s:%s", strings.Join(srcs, " "), e.Address(), dstPath.Path)
+		if err = s.transfer(ctx, localFS{}, srcs, rfs, dstPath.Path, opt); err != nil {
+			return errors.Wrap(err, "failed to upload")
+		}
+		lg.Info("upload completed successfully")
+		return nil
+	}
+	localPath := utils.ExpandHomeDir(dstPath.Path)
+	if hasTrailingSeparator(localFS{}, dstPath.Path) && !hasTrailingSeparator(localFS{}, localPath) {
+		// cleaned by expanding
+		localPath += string(filepath.Separator)
+	}
+	lg.Info("downloading %s:%s -> %s", e.Address(), strings.Join(srcs, " "), localPath)
+	if err = s.transfer(ctx, rfs, srcs, localFS{}, localPath, opt); err != nil {
+		return errors.Wrap(err, "failed to download")
 	}
+	lg.Info("download completed successfully")
+	return nil
+}
 
-	if isUpload {
-		return s.upload(ctx, scpClient, client.cli, localPath, remotePath)
+// command returns the cp command line for history
+func (opt *CpOption) command() string {
+	return strings.Join(append(append([]string{}, opt.Sources...), opt.Target), " ")
+}
+
+// parseCpSources parses the sources, which must be all local or on the same
+// remote host, and returns the first one and the paths of all
+func parseCpSources(sources []string) (*CpPath, []string, error) {
+	if len(sources) == 0 {
+		return nil, nil, errors.New("no source specified")
+	}
+	first := ParseCpPath(sources[0])
+	paths := []string{first.Path}
+	for _, source := range sources[1:] {
+		cp := ParseCpPath(source)
+		if cp.IsRemote != first.IsRemote || cp.RawKeyword != first.RawKeyword ||
+			cp.User != first.User || cp.Host != first.Host || cp.Port != first.Port {
+			return nil, nil, errors.Errorf("sources must be all local or on the same remote host, but got %s and %s", sources[0], source)
+		}
+		paths = append(paths, cp.Path)
 	}
-	return s.download(ctx, scpClient, remotePath, localPath)
+	return first, paths, nil
 }
 
 // copyRemoteToRemote copies file from one remote host to another via streaming
 // The file is streamed through local without being stored on disk
-func (s *SSX) copyRemoteToRemote(ctx context.Context, srcPath, dstPath *CpPath, opt *CpOption) error {
+func (s *SSX) copyRemoteToRemote(ctx context.Context, srcPath *CpPath, srcs []string, dstPath *CpPath, opt *CpOption) (err error) {
 	// Resolve source entry
 	srcEntry, err := s.resolveRemotePath(srcPath, opt)
 	if err != nil {
@@ -171,165 +215,486 @@ func (s *SSX) copyRemoteToRemote(ctx context.Context, srcPath, dstPath *CpPath,
 		return errors.Wrap(err, "failed to resolve destination remote path")
 	}
 	dstPath.Entry = dstEntry
+	srcHistory := newHistory(srcEntry, history.ModeCopy, opt.command())
+	dstHistory := newHistory(dstEntry, history.ModeCopy, opt.command())
+	defer func() {
+		s.saveHistory(srcHistory, srcEntry, err)
+		s.saveHistory(dstHistory, dstEntry, err)
+	}()
 
-	lg.Info("copying %s:%s -> %s:%s (streaming)", srcEntry.Address(), srcPath.Path, dstEntry.Address(), dstPath.Path)
+	lg.Info("copying %s:%s -> %s:%s (streaming)", srcEntry.Address(), strings.Join(srcs, " "), dstEntry.Address(), dstPath.Path)
 
 	// Connect to source host
-	srcClient := NewClient(srcEntry, s.repo)
+	srcClient := s.newClient(srcEntry)
 	if err := srcClient.Login(ctx); err != nil {
 		return errors.Wrap(err, "failed to connect to source host")
 	}
 	defer srcClient.close()
 
 	// Connect to destination host
-	dstClient := NewClient(dstEntry, s.repo)
+	dstClient := s.newClient(dstEntry)
 	if err := dstClient.Login(ctx); err != nil {
 		return errors.Wrap(err, "failed to connect to destination host")
 	}
 	defer dstClient.close()
 
-	// Get file info from source (size and permissions)
-	fileInfo, err := getRemoteFileInfo(srcClient.cli, srcPath.Path)
+	srcFS, err := newRemoteFS(ctx, srcClient.cli, opt.Protocol)
 	if err != nil {
-		return errors.Wrap(err, "failed to get source file info")
+		return err
 	}
-
-	lg.Debug("source file size: %d, mode: %s", fileInfo.size, fileInfo.mode)
-
-	// Resolve destination path (handle directory case)
-	finalDstPath, err := resolveRemoteDestPath(dstClient.cli, dstPath.Path, filepath.Base(srcPath.Path))
+	defer srcFS.Close()
+	dstFS, err := newRemoteFS(ctx, dstClient.cli, opt.Protocol)
 	if err != nil {
-		return errors.Wrap(err, "failed to resolve destination path")
+		return err
+	}
+	defer dstFS.Close()
+
+	if err = s.transfer(ctx, srcFS, srcs, dstFS, dstPath.Path, opt); err != nil {
+		return err
 	}
 
-	// Create pipe for streaming
-	pr, pw := io.Pipe()
+	lg.Info("remote to remote copy completed successfully")
+	return nil
+}
 
-	// Error channels for goroutines
-	downloadErrCh := make(chan error, 1)
-	uploadErrCh := make(chan error, 1)
+// maxCopyDepth limits the depth of directories copied recursively,
+// which may be infinite if symlinks are followed
+const maxCopyDepth = 64
 
-	// Start download goroutine (source -> pipe)
-	go func() {
-		defer pw.Close()
-		scpSrc, err := scp.NewClientBySSH(srcClient.cli)
+// transfer copies srcs of srcFS to dst of dstFS, the directories are copied
+// recursively if opt.Recursive is set. Like cp, sources are copied into dst
+// if dst is an existing directory, which is required if there are several.
+// Sources with glob patterns are expanded on srcFS.
+func (s *SSX) transfer(ctx context.Context, srcFS fileSystem, srcs []string, dstFS fileSystem, dst string, opt *CpOption) error {
+	expanded, err := expandSources(srcFS, srcs)
+	if err != nil {
+		return err
+	}
+	infos := make([]os.FileInfo, len(expanded))
+	hasDir := false
+	for i, src := range expanded {
+		if infos[i], err = srcFS.Stat(src); err != nil {
+			return errors.Wrapf(err, "failed to stat %s", src)
+		}
+		if infos[i].IsDir() && !opt.Recursive {
+			return errors.Errorf("%s is a directory, use -r to copy recursively", src)
+		}
+		hasDir = hasDir || infos[i].IsDir()
+	}
+	dstInfo, err := dstFS.Stat(dst)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrapf(err, "failed to stat %s", dst)
+	}
+	intoDir := err == nil && dstInfo.IsDir()
+	multiple := len(srcs) > 1 || len(expanded) > 1
+	if multiple && !intoDir {
+		return errors.Errorf("target %s is not a directory, which is required by multiple sources", dst)
+	}
+	// like cp, a file is not copied to a missing directory named with a trailing slash
+	if !intoDir && !hasDir && hasTrailingSeparator(dstFS, dst) {
+		return errors.Errorf("target %s is not a directory", dst)
+	}
+
+	c := &treeCopier{ctx: ctx, src: srcFS, dst: dstFS, follow: opt.FollowSymlinks,
+		resume: opt.Resume, verify: opt.Verify, progress: newProgress(opt.Quiet)}
+	if c.progress != nil && (multiple || hasDir) {
+		// the total is measured before copying for the overall progress,
+		// the listings are cached so that directories are read only once
+		c.listings = map[string][]os.FileInfo{}
+		var totalFiles, totalBytes int64
+		for i, src := range expanded {
+			if !infos[i].IsDir() {
+				totalFiles, totalBytes = totalFiles+1, totalBytes+infos[i].Size()
+				continue
+			}
+			files, bytes, err := c.measure(src, 0)
+			if err != nil {
+				return err
+			}
+			totalFiles, totalBytes = totalFiles+files, totalBytes+bytes
+		}
+		c.progress.setTotal(totalFiles, totalBytes)
+	}
+	for i, src := range expanded {
+		target := dst
+		if intoDir {
+			target = dstFS.Join(dst, baseName(srcFS, src))
+		}
+		if infos[i].IsDir() {
+			err = c.copyDir(src, target, infos[i], 0)
+		} else {
+			err = c.copyFile(src, target, infos[i])
+		}
 		if err != nil {
-			downloadErrCh <- errors.Wrap(err, "failed to create source SCP client")
-			return
+			return err
 		}
-		err = scpSrc.CopyFromRemotePassThru(ctx, pw, srcPath.Path, nil)
-		downloadErrCh <- err
-	}()
+	}
+
+	if multiple || hasDir {
+		lg.Info("%d files, %d directories and %d symlinks copied", c.files, c.dirs, c.links)
+	}
+	if c.progress != nil {
+		lg.Info("%s", c.progress.summary())
+	}
+	if c.verify && (multiple || hasDir) {
+		lg.Info("sha256 checksums of %d files verified", c.files)
+	} else if c.verify {
+		lg.Info("sha256 checksum verified")
+	}
+	return nil
+}
 
-	// Start upload goroutine (pipe -> destination)
-	go func() {
-		scpDst, err := scp.NewClientBySSH(dstClient.cli)
+// expandSources expands the sources with glob patterns on fsys,
+// the one existing as is, e.g. a file named 'a[1].log', is not expanded
+func expandSources(fsys fileSystem, srcs []string) ([]string, error) {
+	var expanded []string
+	for _, src := range srcs {
+		if !hasGlobMeta(src) {
+			expanded = append(expanded, src)
+			continue
+		}
+		if _, err := fsys.Lstat(src); err == nil {
+			expanded = append(expanded, src)
+			continue
+		}
+		matches, err := fsys.Glob(src)
 		if err != nil {
-			uploadErrCh <- errors.Wrap(err, "failed to create destination SCP client")
-			return
+			return nil, errors.Wrapf(err, "failed to expand %s", src)
 		}
-		err = scpDst.CopyFile(ctx, pr, finalDstPath, fileInfo.mode)
-		uploadErrCh <- err
-	}()
-
-	// Wait for both operations to complete
-	var downloadErr, uploadErr error
-	for i := 0; i < 2; i++ {
-		select {
-		case downloadErr = <-downloadErrCh:
-			if downloadErr != nil {
-				pr.Close() // Signal upload to stop
-			}
-		case uploadErr = <-uploadErrCh:
-			if uploadErr != nil {
-				pw.Close() // Signal download to stop
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		if len(matches) == 0 {
+			return nil, errors.Errorf("no files matched %s", src)
 		}
+		lg.Debug("%s matched %d files", src, len(matches))
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// baseName returns the last element of p in fsys
+func baseName(fsys fileSystem, p string) string {
+	if _, ok := fsys.(localFS); ok {
+		return filepath.Base(p)
 	}
+	return path.Base(p)
+}
 
-	if downloadErr != nil {
-		return errors.Wrap(downloadErr, "failed to download from source")
+// hasTrailingSeparator reports whether p of fsys ends with a path separator
+func hasTrailingSeparator(fsys fileSystem, p string) bool {
+	if p == "" {
+		return false
 	}
-	if uploadErr != nil {
-		return errors.Wrap(uploadErr, "failed to upload to destination")
+	if _, ok := fsys.(localFS); ok && os.IsPathSeparator(p[len(p)-1]) {
+		return true
 	}
+	return strings.HasSuffix(p, "/")
+}
 
-	lg.Info("remote to remote copy completed successfully")
-	return nil
+// treeCopier copies files and directories between file systems
+type treeCopier struct {
+	ctx    context.Context
+	src    fileSystem
+	dst    fileSystem
+	follow bool // copy the targets of symlinks instead of symlinks
+	resume bool
+	verify bool
+
+	progress *progress
+	listings map[string][]os.FileInfo // directories read by measure
+
+	files, dirs, links int
 }
 
-// remoteFileInfo holds basic file information from remote host
-type remoteFileInfo struct {
-	size int64
-	mode string
+// readDir reads the directory src, the listing cached by measure is used once
+func (c *treeCopier) readDir(src string) ([]os.FileInfo, error) {
+	if children, ok := c.listings[src]; ok {
+		delete(c.listings, src)
+		return children, nil
+	}
+	return c.src.ReadDir(src)
 }
 
-// getRemoteFileInfo gets file size and permissions from remote host via SSH
-func getRemoteFileInfo(client *ssh.Client, remotePath string) (*remoteFileInfo, error) {
-	session, err := client.NewSession()
+// measure returns the number and total size of regular files to be copied in directory src
+func (c *treeCopier) measure(src string, depth int) (files, bytes int64, err error) {
+	if depth > maxCopyDepth {
+		return 0, 0, errors.Errorf("too many levels of directories at %s, symlink loop?", src)
+	}
+	children, err := c.src.ReadDir(src)
 	if err != nil {
-		return nil, err
+		return 0, 0, errors.Wrapf(err, "failed to read directory %s", src)
+	}
+	c.listings[src] = children
+	for _, child := range children {
+		if err = c.ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		p := c.src.Join(src, child.Name())
+		if child.Mode()&os.ModeSymlink != 0 {
+			if !c.follow {
+				continue
+			}
+			if child, err = c.src.Stat(p); err != nil {
+				continue
+			}
+		}
+		switch {
+		case child.IsDir():
+			n, size, err := c.measure(p, depth+1)
+			if err != nil {
+				return 0, 0, err
+			}
+			files, bytes = files+n, bytes+size
+		case child.Mode().IsRegular():
+			files, bytes = files+1, bytes+child.Size()
+		}
+	}
+	return files, bytes, nil
+}
+
+func (c *treeCopier) copyDir(src, dst string, info os.FileInfo, depth int) error {
+	if depth > maxCopyDepth {
+		return errors.Errorf("too many levels of directories at %s, symlink loop?", src)
+	}
+	if err := c.dst.MkdirAll(dst); err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", dst)
+	}
+	c.dirs++
+	children, err := c.readDir(src)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read directory %s", src)
+	}
+	for _, child := range children {
+		if err = c.ctx.Err(); err != nil {
+			return err
+		}
+		err = c.copyEntry(c.src.Join(src, child.Name()), c.dst.Join(dst, child.Name()), child, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	// the mode is set at last, in case the directory is not writable
+	return errors.Wrapf(c.dst.Chmod(dst, info.Mode().Perm()), "failed to change mode of %s", dst)
+}
+
+// copyEntry copies an entry of directory, info is not followed if it is a symlink
+func (c *treeCopier) copyEntry(src, dst string, info os.FileInfo, depth int) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !c.follow {
+			return c.copySymlink(src, dst)
+		}
+		target, err := c.src.Stat(src)
+		if err != nil {
+			lg.Warn("skip broken symlink %s: %s", src, err)
+			return nil
+		}
+		info = target
 	}
-	defer session.Close()
+	switch {
+	case info.IsDir():
+		return c.copyDir(src, dst, info, depth)
+	case info.Mode().IsRegular():
+		return c.copyFile(src, dst, info)
+	default:
+		lg.Warn("skip %s, unsupported file type: %s", src, info.Mode().Type())
+		return nil
+	}
+}
 
-	// Use stat command to get file info
-	// Output format: size mode (e.g., "1234 0644")
-	cmd := fmt.Sprintf(`stat -c '%%s %%a' '%s' 2>/dev/null || stat -f '%%z %%Lp' '%s'`, remotePath, remotePath)
-	output, err := session.Output(cmd)
+// copySymlink creates the symlink with the same target, which is not rewritten
+func (c *treeCopier) copySymlink(src, dst string) error {
+	target, err := c.src.ReadLink(src)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to stat remote file %s", remotePath)
+		return errors.Wrapf(err, "failed to read symlink %s", src)
+	}
+	// replace the existing one like cp
+	if _, err = c.dst.Lstat(dst); err == nil {
+		_ = c.dst.Remove(dst)
 	}
+	lg.Debug("symlink %s -> %s", dst, target)
+	if err = c.dst.Symlink(target, dst); err != nil {
+		return errors.Wrapf(err, "failed to create symlink %s", dst)
+	}
+	c.links++
+	return nil
+}
 
-	var size int64
-	var mode string
-	_, err = fmt.Sscanf(strings.TrimSpace(string(output)), "%d %s", &size, &mode)
+// partialSuffix is appended to the name of target while copying, the partial
+// file is renamed to the target once completed, so that the existing target
+// is not truncated by a failed copy
+const partialSuffix = ".ssx-part"
+
+func (c *treeCopier) copyFile(src, dst string, info os.FileInfo) error {
+	name := baseName(c.src, src)
+	part := dst + partialSuffix
+	if c.resume && c.complete(src, dst, info.Size()) {
+		lg.Info("%s is complete already", dst)
+		// the partial file left by the previous copy is useless
+		_ = c.dst.Remove(part)
+		c.progress.startFile(name, info.Size(), info.Size())
+		c.progress.finishFile(nil)
+		c.files++
+		return nil
+	}
+	offset := c.resumeOffset(src, part, info.Size())
+	lg.Debug("copying %s -> %s, size: %d, mode: %s, offset: %d", src, part, info.Size(), info.Mode(), offset)
+	c.progress.startFile(name, info.Size(), offset)
+	var err error
+	if offset == 0 || offset < info.Size() {
+		err = c.copyContent(src, part, info, offset)
+	}
+	c.progress.finishFile(err)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse stat output")
+		// clean up partial file, unless it is kept for resuming
+		if !c.resume {
+			_ = c.dst.Remove(part)
+		}
+		return err
+	}
+	if c.verify {
+		if err = c.verifyFile(src, part); err != nil {
+			_ = c.dst.Remove(part)
+			return err
+		}
+	}
+	if err = c.dst.Rename(part, dst); err != nil {
+		return errors.Wrapf(err, "failed to rename %s to %s", part, dst)
 	}
+	c.files++
+	return nil
+}
 
-	// Ensure mode is 4 digits
-	if len(mode) < 4 {
-		mode = "0" + mode
+// complete checks if dst has the same size and content as src
+func (c *treeCopier) complete(src, dst string, size int64) bool {
+	info, err := c.dst.Stat(dst)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return false
+	}
+	if err = c.checkPrefix(src, dst, size); err != nil {
+		lg.Debug("%s is not complete: %s", dst, err)
+		return false
 	}
+	return true
+}
 
-	return &remoteFileInfo{size: size, mode: mode}, nil
+// resumeOffset returns the size of the partial file to resume from, or 0 to copy from scratch,
+// the partial file is resumed only if its content is the same as the beginning of src
+func (c *treeCopier) resumeOffset(src, part string, size int64) int64 {
+	if !c.resume {
+		return 0
+	}
+	info, err := c.dst.Stat(part)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return 0
+	}
+	if info.Size() > size {
+		lg.Warn("%s is larger than the source, copy it from scratch", part)
+		return 0
+	}
+	if err = c.checkPrefix(src, part, info.Size()); err != nil {
+		lg.Warn("%s, copy it from scratch", err)
+		return 0
+	}
+	lg.Info("resuming %s from %s", part, formatBytes(info.Size()))
+	return info.Size()
 }
 
-// isRemoteDir checks if a remote path is a directory
-func isRemoteDir(client *ssh.Client, remotePath string) (bool, error) {
-	session, err := client.NewSession()
+// checkPrefix compares SHA-256 checksums of the first n bytes of src and dst
+func (c *treeCopier) checkPrefix(src, dst string, n int64) error {
+	srcSum, err := c.src.Sum(src, n)
 	if err != nil {
-		return false, err
+		return errors.Wrapf(err, "failed to compute checksum of %s", src)
 	}
-	defer session.Close()
-
-	// Use test -d to check if path is a directory
-	cmd := fmt.Sprintf(`test -d '%s' && echo "dir" || echo "notdir"`, remotePath)
-	output, err := session.Output(cmd)
+	dstSum, err := c.dst.Sum(dst, n)
 	if err != nil {
-		return false, nil // Path doesn't exist, treat as file
+		return errors.Wrapf(err, "failed to compute checksum of %s", dst)
 	}
-
-	return strings.TrimSpace(string(output)) == "dir", nil
+	if srcSum != dstSum {
+		return errors.Errorf("%s does not match the source", dst)
+	}
+	return nil
 }
 
-// resolveRemoteDestPath resolves the final destination path on remote host
-// If destPath is a directory, appends srcFileName to it
-func resolveRemoteDestPath(client *ssh.Client, destPath, srcFileName string) (string, error) {
-	isDir, err := isRemoteDir(client, destPath)
+// copyContent copies content of src from offset to the end of dst
+func (c *treeCopier) copyContent(src, dst string, info os.FileInfo, offset int64) error {
+	var (
+		r   io.ReadCloser
+		w   io.WriteCloser
+		err error
+	)
+	if offset > 0 {
+		r, err = c.src.OpenAt(src, offset)
+	} else {
+		r, err = c.src.Open(src)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", src)
+	}
+	defer r.Close()
+	if offset > 0 {
+		w, err = c.dst.Append(dst)
+	} else {
+		w, err = c.dst.Create(dst, info.Mode(), info.Size())
+	}
 	if err != nil {
-		return "", err
+		return errors.Wrapf(err, "failed to create %s", dst)
 	}
+	if err = copyWithContext(c.ctx, c.progress.writer(w), r); err == nil {
+		err = w.Close()
+	} else {
+		_ = w.Close()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to copy %s", src)
+	}
+	if offset > 0 {
+		// the mode is set by Create only
+		return errors.Wrapf(c.dst.Chmod(dst, info.Mode().Perm()), "failed to change mode of %s", dst)
+	}
+	return nil
+}
 
-	if isDir {
-		// Destination is a directory, append source filename
-		return filepath.Join(destPath, srcFileName), nil
+// verifyFile compares SHA-256 checksums of src and dst
+func (c *treeCopier) verifyFile(src, dst string) error {
+	srcSum, err := c.src.Sum(src, -1)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute checksum of %s", src)
+	}
+	dstSum, err := c.dst.Sum(dst, -1)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute checksum of %s", dst)
 	}
+	if srcSum != dstSum {
+		return errors.Errorf("checksum mismatch, sha256 of %s is %s, but %s of %s", src, srcSum, dstSum, dst)
+	}
+	lg.Debug("sha256 of %s verified: %s", dst, dstSum)
+	return nil
+}
+
+// copyBufferSize is large enough for sftp to read and write concurrently
+const copyBufferSize = 1 << 20
+
+// copyWithContext copies src to dst until EOF, an error or ctx is done
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) error {
+	// hide io.ReaderFrom of dst so that the buffer is used
+	dst = struct{ io.Writer }{dst}
+	_, err := io.CopyBuffer(dst, &contextReader{ctx: ctx, r: src}, make([]byte, copyBufferSize))
+	return err
+}
 
-	// Destination is a file path (or doesn't exist yet)
-	return destPath, nil
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
 }
 
 // resolveRemotePath resolves a remote CpPath to an Entry
@@ -372,78 +737,3 @@ func (s *SSX) resolveRemotePath(cp *CpPath, opt *CpOption) (*entry.Entry, error)
 
 	return e, nil
 }
-
-// upload copies a local file to remote host
-func (s *SSX) upload(ctx context.Context, scpClient scp.Client, sshClient *ssh.Client, localPath string, remotePath *CpPath) error {
-	localPath = utils.ExpandHomeDir(localPath)
-
-	// Check if local file exists
-	fileInfo, err := os.Stat(localPath)
-	if err != nil {
-		return errors.Wrapf(err, "failed to stat local file %s", localPath)
-	}
-
-	if fileInfo.IsDir() {
-		return errors.New("directory upload is not supported yet, please use tar to archive first")
-	}
-
-	// Open local file
-	f, err := os.Open(localPath)
-	if err != nil {
-		return errors.Wrapf(err, "failed to open local file %s", localPath)
-	}
-	defer f.Close()
-
-	// Get file permission
-	perm := fmt.Sprintf("%04o", fileInfo.Mode().Perm())
-
-	// Resolve destination path (handle directory case)
-	finalRemotePath, err := resolveRemoteDestPath(sshClient, remotePath.Path, filepath.Base(localPath))
-	if err != nil {
-		return errors.Wrap(err, "failed to resolve remote destination path")
-	}
-
-	lg.Info("uploading %s -> %s:%s", localPath, remotePath.Entry.Address(), finalRemotePath)
-
-	// Copy file to remote
-	err = scpClient.CopyFromFile(ctx, *f, finalRemotePath, perm)
-	if err != nil {
-		return errors.Wrap(err, "failed to upload file")
-	}
-
-	lg.Info("upload completed successfully")
-	return nil
-}
-
-// download copies a remote file to local
-func (s *SSX) download(ctx context.Context, scpClient scp.Client, remotePath *CpPath, localPath string) error {
-	localPath = utils.ExpandHomeDir(localPath)
-
-	// Resolve local destination path (handle directory case)
-	localInfo, err := os.Stat(localPath)
-	if err == nil && localInfo.IsDir() {
-		// Local path is a directory, append source filename
-		localPath = filepath.Join(localPath, filepath.Base(remotePath.Path))
-	}
-
-	// Create local file
-	f, err := os.Create(localPath)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create local file %s", localPath)
-	}
-	defer f.Close()
-
-	lg.Info("downloading %s:%s -> %s", remotePath.Entry.Address(), remotePath.Path, localPath)
-
-	// Copy file from remote
-	err = scpClient.CopyFromRemote(ctx, f, remotePath.Path)
-	if err != nil {
-		// Clean up partial file on error
-		f.Close()
-		os.Remove(localPath)
-		return errors.Wrap(err, "failed to download file")
-	}
-
-	lg.Info("download completed successfully")
-	return nil
-}
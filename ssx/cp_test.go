@@ -1,7 +1,12 @@
 package ssx
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -128,3 +133,103 @@ func TestParseCpPath(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", formatBytes(512))
+	assert.Equal(t, "1.5KiB", formatBytes(1536))
+	assert.Equal(t, "2.0GiB", formatBytes(2<<30))
+}
+
+func TestProgressStatus(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	p := &progress{now: func() time.Time { return now }, start: now}
+	p.setTotal(2, 3<<20)
+	p.startFile("a.bin", 2<<20, 0)
+	now = now.Add(2 * time.Second)
+	p.cur = 1 << 20
+	assert.Equal(t, "   1.0MiB/2.0MiB     50%  512.0KiB/s ETA 2s       | total 0/2 files  33% ETA 4s", p.status())
+
+	p.cur = 2 << 20
+	p.finishFile(nil)
+	assert.Equal(t, int64(1), p.doneFiles)
+	assert.Equal(t, "2.0MiB transferred in 2s, 1.0MiB/s", p.summary())
+}
+
+func TestProgressDrawResumed(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var out bytes.Buffer
+	p := &progress{out: &out, tty: true, width: 120, now: func() time.Time { return now }, start: now}
+	p.startFile("a.bin", 100, 50)
+	p.cur = 25
+	p.draw()
+	// the bar starts from the resumed offset
+	assert.Contains(t, out.String(), "[===============     ]")
+}
+
+func TestParseCpSources(t *testing.T) {
+	first, paths, err := parseCpSources([]string{"web1:/var/log/a.log", "web1:/var/log/*.gz"})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "web1", first.RawKeyword)
+	assert.Equal(t, []string{"/var/log/a.log", "/var/log/*.gz"}, paths)
+
+	_, _, err = parseCpSources([]string{"a.log", "web1:/tmp/b.log"})
+	assert.Error(t, err)
+	_, _, err = parseCpSources([]string{"web1:/tmp/a.log", "web2:/tmp/b.log"})
+	assert.Error(t, err)
+	_, _, err = parseCpSources(nil)
+	assert.Error(t, err)
+}
+
+func TestTransferTrailingSlash(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0o755); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	for _, name := range []string{"a.log", "b.txt", "sub/c.txt"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+	}
+	s := &SSX{}
+	ctx := context.Background()
+	transfer := func(srcs []string, dst string, recursive bool) error {
+		return s.transfer(ctx, localFS{}, srcs, localFS{}, dst, &CpOption{Quiet: true, Recursive: recursive})
+	}
+
+	// a single glob match is not written as a file named by the missing directory
+	missing := filepath.Join(dir, "missing")
+	err := transfer([]string{filepath.Join(src, "*.log")}, missing+"/", false)
+	assert.ErrorContains(t, err, "is not a directory")
+	_, err = os.Stat(missing)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = transfer([]string{filepath.Join(src, "b.txt")}, missing+"/", false)
+	assert.ErrorContains(t, err, "is not a directory")
+
+	// copied into the existing directory
+	out := filepath.Join(dir, "out")
+	if err = os.Mkdir(out, 0o755); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if err = transfer([]string{filepath.Join(src, "*.log")}, out+"/", false); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "a.log"))
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "a.log", string(data))
+
+	// a directory is copied as the missing one like cp -r
+	if err = transfer([]string{filepath.Join(src, "sub")}, missing+"/", true); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	data, err = os.ReadFile(filepath.Join(missing, "c.txt"))
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "sub/c.txt", string(data))
+}
@@ -0,0 +1,54 @@
+package entry
+
+import (
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/ssx/cleaner"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+var (
+	agentOnce   sync.Once
+	agentClient agent.ExtendedAgent
+)
+
+// sshAgent connects to the running ssh-agent through SSH_AUTH_SOCK,
+// the connection is shared by all hops and closed when ssx exits.
+// It returns nil if there is no agent available.
+func sshAgent() agent.ExtendedAgent {
+	agentOnce.Do(func() {
+		sock := os.Getenv(env.SSHAuthSock)
+		if sock == "" {
+			lg.Debug("%s not set, skip ssh-agent", env.SSHAuthSock)
+			return
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			lg.Debug("failed to connect ssh-agent %q: %s", sock, err)
+			return
+		}
+		cleaner.RegisterCallback(func() {
+			_ = conn.Close()
+		})
+		agentClient = agent.NewClient(conn)
+	})
+	return agentClient
+}
+
+// agentSigners returns the signers held in ssh-agent, it is called
+// on each public key authentication so that keys added later are used
+func agentSigners(ag agent.ExtendedAgent) []ssh.Signer {
+	signers, err := ag.Signers()
+	if err != nil {
+		lg.Debug("failed to list ssh-agent signers: %s", err)
+		return nil
+	}
+	lg.Debug("ssh-agent offered %d keys", len(signers))
+	return signers
+}
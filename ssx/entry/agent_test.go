@@ -0,0 +1,165 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/vimiix/ssx/internal/terminal"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+// resetSSHAgent makes sshAgent connect again in the test,
+// and drops the connection made by the test when it ends
+func resetSSHAgent(t *testing.T) {
+	reset := func() {
+		agentOnce = sync.Once{}
+		agentClient = nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// startTestAgent serves an ssh-agent holding key through SSH_AUTH_SOCK
+func startTestAgent(t *testing.T, key ed25519.PrivateKey) {
+	resetSSHAgent(t)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, acceptErr := ln.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv(env.SSHAuthSock, sock)
+}
+
+// startTestServer starts a ssh server which only accepts public key authorized
+func startTestServer(t *testing.T, authorized ssh.PublicKey) string {
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, errors.New("unauthorized key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, acceptErr := ln.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				sconn, chans, reqs, handshakeErr := ssh.NewServerConn(conn, config)
+				if handshakeErr != nil {
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					_ = nc.Reject(ssh.Prohibited, "not supported")
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestSSHAgent(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	startTestAgent(t, priv)
+
+	ag := sshAgent()
+	if ag == nil {
+		t.Fatal("expect ssh-agent connected")
+	}
+	assert.Len(t, agentSigners(ag), 1)
+}
+
+func TestSSHAgentUnavailable(t *testing.T) {
+	resetSSHAgent(t)
+	t.Setenv(env.SSHAuthSock, "")
+	assert.Nil(t, sshAgent())
+
+	resetSSHAgent(t)
+	t.Setenv(env.SSHAuthSock, filepath.Join(t.TempDir(), "missing.sock"))
+	assert.Nil(t, sshAgent())
+}
+
+// key files are still offered after the keys in ssh-agent are rejected
+func TestAuthMethods_agentKeyRejected(t *testing.T) {
+	_, agentKey, _ := ed25519.GenerateKey(rand.Reader)
+	startTestAgent(t, agentKey)
+
+	_, fileKey, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(fileKey, "")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	keyfile := filepath.Join(t.TempDir(), "id_test")
+	if err = os.WriteFile(keyfile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	fileSigner, _ := ssh.NewSignerFromKey(fileKey)
+	host, port, _ := net.SplitHostPort(startTestServer(t, fileSigner.PublicKey()))
+
+	ctx := terminal.DisablePrompt(context.Background())
+	e := &Entry{Host: host, Port: port, User: "test", KeyPath: keyfile, HostKeyPolicy: HostKeyPolicyOff}
+	p := &Proxy{Host: host, Port: port, User: "test", KeyPath: keyfile, HostKeyPolicy: HostKeyPolicyOff}
+	for name, genConfig := range map[string]func(context.Context) (*ssh.ClientConfig, error){
+		"entry": e.GenSSHConfig,
+		"proxy": p.GenSSHConfig,
+	} {
+		t.Run(name, func(t *testing.T) {
+			config, err := genConfig(ctx)
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			cli, err := ssh.Dial("tcp", net.JoinHostPort(host, port), config)
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			_ = cli.Close()
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/terminal"
+	"github.com/vimiix/ssx/internal/totp"
+	"github.com/vimiix/ssx/internal/utils"
+)
+
+// credential holds the authentication settings of a single hop, an entry or
+// a jump server. The secrets entered interactively are written back to the
+// owner through password and passphrase pointers.
+type credential struct {
+	user         string
+	host         string
+	keyPath      string
+	certFile     string
+	totpSecret   string
+	disableAgent bool
+	password     *string
+	passphrase   *string
+}
+
+func (c *credential) keyAbsPath() string {
+	return utils.ExpandHomeDir(c.keyPath)
+}
+
+// authMethods all possible auth methods
+func (c *credential) authMethods(ctx context.Context) ([]ssh.AuthMethod, error) {
+	var authMethods []ssh.AuthMethod
+	// password auth
+	if *c.password != "" {
+		authMethods = append(authMethods, ssh.Password(*c.password))
+	}
+
+	// public key auth with ssh-agent, key files and certificates
+	keysAuth, err := c.publicKeysAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if keysAuth != nil {
+		authMethods = append(authMethods, keysAuth)
+	}
+	storePassword := func(password string) { *c.password = password }
+	authMethods = append(authMethods,
+		interactAuth(ctx, c.user, c.host, *c.password, c.totpSecret, storePassword),
+		passwordCallback(ctx, c.user, c.host, storePassword),
+	)
+	return authMethods, nil
+}
+
+// promptMu serializes prompts on terminal when several entries are connected at once
+var promptMu sync.Mutex
+
+func passwordCallback(ctx context.Context, user, host string, storePassFunc func(password string)) ssh.AuthMethod {
+	prompt := func() (string, error) {
+		lg.Debug("login through password callback")
+		if err := terminal.CheckPrompt(ctx); err != nil {
+			return "", err
+		}
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		fmt.Printf("%s@%s's password:", user, host)
+		bs, readErr := terminal.ReadPassword(ctx)
+		fmt.Println()
+		if readErr != nil {
+			return "", readErr
+		}
+		p := string(bs)
+		if storePassFunc != nil {
+			storePassFunc(p)
+		}
+		return p, nil
+	}
+	return ssh.PasswordCallback(prompt)
+}
+
+// otpQuestion matches keyboard-interactive questions asking for a one-time password,
+// e.g. "Verification code:" of Google Authenticator, words like "token" or "passcode"
+// alone are not matched as they are asked for other secrets as well
+var otpQuestion = regexp.MustCompile(`(?i)\b(verification code|one[- ]time (password|passcode|code)|(authenticator|2fa|mfa) code|t?otp)\b`)
+
+func isOTPQuestion(question string) bool {
+	return otpQuestion.MatchString(question)
+}
+
+func isPasswordQuestion(question string) bool {
+	return utils.ContainsI(question, "password") && !isOTPQuestion(question)
+}
+
+// interactAuth answers keyboard-interactive challenges such as PAM, Google Authenticator
+// or RADIUS OTP. Password and verification code questions are answered once with the
+// stored password and totp seed, the others are prompted with the name of the asking host.
+func interactAuth(ctx context.Context, user, host, password, totpSecret string, storePassFunc func(password string)) ssh.AuthMethod {
+	var (
+		who          = fmt.Sprintf("%s@%s", user, host)
+		usedPassword bool
+		usedTOTP     bool
+	)
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		lg.Debug("login through keyboard-interactive, %d questions", len(questions))
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		if name != "" {
+			fmt.Printf("[%s] %s\n", who, name)
+		}
+		if instruction != "" {
+			fmt.Printf("[%s] %s\n", who, instruction)
+		}
+		answers := make([]string, 0, len(questions))
+		for i, q := range questions {
+			if isOTPQuestion(q) && totpSecret != "" && !usedTOTP {
+				usedTOTP = true
+				code, err := totp.Generate(totpSecret, time.Now())
+				if err != nil {
+					return nil, err
+				}
+				lg.Debug("answer %q of %s with totp code", q, who)
+				answers = append(answers, code)
+				continue
+			}
+			if isPasswordQuestion(q) && password != "" && !usedPassword {
+				usedPassword = true
+				answers = append(answers, password)
+				continue
+			}
+
+			if err := terminal.CheckPrompt(ctx); err != nil {
+				return nil, err
+			}
+			fmt.Printf("[%s] %s", who, q)
+			var answer string
+			if echos[i] {
+				line, err := terminal.ReadLine(ctx)
+				if err != nil {
+					return nil, err
+				}
+				answer = line
+			} else {
+				bs, err := terminal.ReadPassword(ctx)
+				fmt.Println()
+				if err != nil {
+					return nil, err
+				}
+				answer = string(bs)
+			}
+			if isPasswordQuestion(q) && storePassFunc != nil {
+				storePassFunc(answer)
+			}
+			answers = append(answers, answer)
+		}
+		return answers, nil
+	})
+}
+
+// publicKeysAuth offers the keys held in ssh-agent, then the key files and
+// their certificates. They are gathered in one method because ssh does not
+// try another method of the same name once one of them failed.
+// It returns nil if there is no key available.
+func (c *credential) publicKeysAuth(ctx context.Context) (ssh.AuthMethod, error) {
+	var ag agent.ExtendedAgent
+	if !c.disableAgent {
+		ag = sshAgent()
+	}
+	keySigners, err := c.keyfileSigners(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ag == nil && len(keySigners) == 0 {
+		return nil, nil
+	}
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		if ag != nil {
+			signers = agentSigners(ag)
+		}
+		return uniqueSigners(append(signers, keySigners...)), nil
+	}), nil
+}
+
+// uniqueSigners removes the signers whose public key is offered already,
+// e.g. a key file which is loaded into ssh-agent as well
+func uniqueSigners(signers []ssh.Signer) []ssh.Signer {
+	var (
+		result []ssh.Signer
+		seen   = map[string]bool{}
+	)
+	for _, s := range signers {
+		key := string(s.PublicKey().Marshal())
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, s)
+	}
+	return result
+}
+
+func (c *credential) keyfileSigners(ctx context.Context) ([]ssh.Signer, error) {
+	keyfiles := c.collectKeyfiles()
+	if len(keyfiles) == 0 {
+		return nil, nil
+	}
+	var signers []ssh.Signer
+	for _, f := range keyfiles {
+		if !utils.FileExists(f) {
+			lg.Debug("keyfile %s not found, skip", f)
+			continue
+		}
+		fileSigners, err := c.keyfileSigner(ctx, f)
+		if err != nil {
+			lg.Debug("skip use keyfile: %s", f)
+			continue
+		}
+		signers = append(signers, fileSigners...)
+	}
+	return signers, nil
+}
+
+// keyfileSigner returns the signer of keypath, preceded by the signer of its certificate if any
+func (c *credential) keyfileSigner(ctx context.Context, keypath string) ([]ssh.Signer, error) {
+	lg.Debug("parsing key file: %s", keypath)
+	pemBytes, err := os.ReadFile(keypath)
+	if err != nil {
+		lg.Error("failed to read file %q: %s", keypath, err)
+		return nil, err
+	}
+	var signer ssh.Signer
+	signer, err = ssh.ParsePrivateKey(pemBytes)
+	passphraseMissingError := &ssh.PassphraseMissingError{}
+	if err != nil {
+		if keypath != c.keyAbsPath() {
+			lg.Debug("parse failed, ignore keyfile %q", keypath)
+			return nil, err
+		}
+		if errors.As(err, &passphraseMissingError) {
+			if *c.passphrase != "" {
+				signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(*c.passphrase))
+			} else if err = terminal.CheckPrompt(ctx); err != nil {
+				return nil, err
+			} else {
+				promptMu.Lock()
+				fmt.Printf("please enter passphrase of key file %s:", keypath)
+				bs, readErr := terminal.ReadPassword(ctx)
+				fmt.Println()
+				promptMu.Unlock()
+				if readErr != nil {
+					return nil, readErr
+				}
+				// write back to entry instance
+				*c.passphrase = string(bs)
+				signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, bs)
+			}
+		}
+	}
+	if err != nil {
+		lg.Error("failed to parse private key file: %s", err)
+		return nil, err
+	}
+	if certSigner := c.certSigner(keypath, signer); certSigner != nil {
+		// offer the certificate first, fallback to the plain key
+		return []ssh.Signer{certSigner, signer}, nil
+	}
+	return []ssh.Signer{signer}, nil
+}
+
+// certificateFiles returns the candidate certificate paths for keypath
+func (c *credential) certificateFiles(keypath string) []string {
+	files := []string{keypath + "-cert.pub"}
+	if c.certFile != "" {
+		files = append([]string{utils.ExpandHomeDir(c.certFile)}, files...)
+	}
+	return files
+}
+
+// certSigner looks for an unexpired certificate of the signer's public key
+// and returns a certificate signer, or nil if there is none
+func (c *credential) certSigner(keypath string, signer ssh.Signer) ssh.Signer {
+	for _, f := range c.certificateFiles(keypath) {
+		if !utils.FileExists(f) {
+			continue
+		}
+		cert, err := loadCertificate(f)
+		if err != nil {
+			lg.Warn("ignore certificate %s: %s", f, err)
+			continue
+		}
+		if !bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()) {
+			lg.Debug("certificate %s does not match key %s, skip", f, keypath)
+			continue
+		}
+		if certExpired(cert, time.Now()) {
+			lg.Warn("certificate %s expired at %s, skip", f, certValidBefore(cert).Format(time.RFC3339))
+			continue
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			lg.Debug("failed to create certificate signer from %s: %s", f, err)
+			continue
+		}
+		lg.Debug("using certificate %s", f)
+		return certSigner
+	}
+	return nil
+}
+
+func loadCertificate(certFile string) (*ssh.Certificate, error) {
+	bs, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(bs)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("not an OpenSSH certificate")
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, errors.New("not a user certificate")
+	}
+	return cert, nil
+}
+
+func certValidBefore(cert *ssh.Certificate) time.Time {
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}
+	}
+	return time.Unix(int64(cert.ValidBefore), 0)
+}
+
+func certExpired(cert *ssh.Certificate, now time.Time) bool {
+	before := certValidBefore(cert)
+	return !before.IsZero() && now.After(before)
+}
+
+// CertificateInfo describes an OpenSSH user certificate available for entry
+type CertificateInfo struct {
+	Path        string
+	KeyID       string
+	Principals  []string
+	ValidBefore time.Time // zero value means forever
+	Expired     bool
+}
+
+func (c *credential) certificates() []*CertificateInfo {
+	var (
+		infos []*CertificateInfo
+		seen  = map[string]bool{}
+	)
+	for _, keyfile := range c.collectKeyfiles() {
+		for _, f := range c.certificateFiles(keyfile) {
+			if seen[f] || !utils.FileExists(f) {
+				continue
+			}
+			seen[f] = true
+			cert, err := loadCertificate(f)
+			if err != nil {
+				lg.Debug("ignore certificate %s: %s", f, err)
+				continue
+			}
+			infos = append(infos, &CertificateInfo{
+				Path:        f,
+				KeyID:       cert.KeyId,
+				Principals:  cert.ValidPrincipals,
+				ValidBefore: certValidBefore(cert),
+				Expired:     certExpired(cert, time.Now()),
+			})
+		}
+	}
+	return infos
+}
+
+// defaultRSAKeyFiles List of possible key files
+// The order of the list represents the priority
+var defaultRSAKeyFiles = []string{
+	"id_rsa", "id_ecdsa", "id_ecdsa_sk",
+	"id_ed25519", "id_ed25519_sk",
+}
+
+func (c *credential) collectKeyfiles() []string {
+	var keypaths []string
+	if c.keyPath != "" && utils.FileExists(c.keyPath) {
+		keypaths = append(keypaths, c.keyAbsPath())
+	}
+	u, err := user.Current()
+	if err != nil {
+		lg.Debug("failed to get current user, ignore default rsa keys")
+		return keypaths
+	}
+	for _, fn := range defaultRSAKeyFiles {
+		fp := filepath.Join(u.HomeDir, ".ssh", fn)
+		if fp == c.keyAbsPath() || !utils.FileExists(fp) {
+			continue
+		}
+		keypaths = append(keypaths, fp)
+	}
+	return keypaths
+}
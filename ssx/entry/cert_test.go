@@ -0,0 +1,86 @@
+package entry
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func writeTestKeyAndCert(t *testing.T, dir string, validBefore time.Time) string {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	keyfile := filepath.Join(dir, "id_ed25519")
+	if err = os.WriteFile(keyfile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	_, caPriv, _ := ed25519.GenerateKey(rand.Reader)
+	caSigner, _ := ssh.NewSignerFromKey(caPriv)
+	signer, _ := ssh.NewSignerFromKey(priv)
+	cert := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		KeyId:           "alice@example",
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"alice"},
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	if err = cert.SignCert(rand.Reader, caSigner); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if err = os.WriteFile(keyfile+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0600); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	return keyfile
+}
+
+func TestEntry_certSigner(t *testing.T) {
+	keyfile := writeTestKeyAndCert(t, t.TempDir(), time.Now().Add(time.Hour))
+	e := &Entry{KeyPath: keyfile}
+	bs, _ := os.ReadFile(keyfile)
+	signer, err := ssh.ParsePrivateKey(bs)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	certSigner := e.credential().certSigner(keyfile, signer)
+	if assert.NotNil(t, certSigner) {
+		_, isCert := certSigner.PublicKey().(*ssh.Certificate)
+		assert.True(t, isCert)
+	}
+
+	certs := e.Certificates()
+	if assert.Len(t, certs, 1) {
+		assert.Equal(t, "alice@example", certs[0].KeyID)
+		assert.Equal(t, []string{"alice"}, certs[0].Principals)
+		assert.False(t, certs[0].Expired)
+	}
+}
+
+func TestEntry_certSignerExpired(t *testing.T) {
+	keyfile := writeTestKeyAndCert(t, t.TempDir(), time.Now().Add(-time.Hour))
+	e := &Entry{KeyPath: keyfile}
+	bs, _ := os.ReadFile(keyfile)
+	signer, err := ssh.ParsePrivateKey(bs)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Nil(t, e.credential().certSigner(keyfile, signer))
+
+	certs := e.Certificates()
+	if assert.Len(t, certs, 1) {
+		assert.True(t, certs[0].Expired)
+	}
+}
@@ -25,3 +25,28 @@ func TestEntry_Tidy(t *testing.T) {
 	assert.Equal(t, "22", e.Port)
 	assert.Equal(t, defaultIdentityFile, e.KeyPath)
 }
+
+func TestIsOTPQuestion(t *testing.T) {
+	assert.True(t, isOTPQuestion("Verification code: "))
+	assert.True(t, isOTPQuestion("One-time password (OATH) for `root': "))
+	assert.True(t, isOTPQuestion("OTP: "))
+	assert.True(t, isOTPQuestion("Enter your MFA code:"))
+	assert.False(t, isOTPQuestion("Enter PASSCODE:"))
+	assert.False(t, isOTPQuestion("Access token: "))
+	assert.False(t, isOTPQuestion("Favorite dish (hotpot?): "))
+	assert.False(t, isOTPQuestion("Password: "))
+
+	assert.True(t, isPasswordQuestion("Password: "))
+	assert.True(t, isPasswordQuestion("root@host's password:"))
+	assert.False(t, isPasswordQuestion("One-time password (OATH) for `root': "))
+}
+
+func TestEntry_JumpServer(t *testing.T) {
+	e := &Entry{Proxy: &Proxy{Host: "a", Proxy: &Proxy{Host: "b"}}}
+	p, err := e.JumpServer(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", p.Host)
+
+	_, err = e.JumpServer(3)
+	assert.Error(t, err)
+}
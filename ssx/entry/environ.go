@@ -0,0 +1,56 @@
+package entry
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Environ returns the environment variables sent on session start in KEY=VALUE form,
+// local variables matched by SendEnv are passed through and overridden by SetEnv
+func (e *Entry) Environ() []string {
+	vars := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		for _, pattern := range e.SendEnv {
+			if ok, _ := path.Match(pattern, name); ok {
+				vars[name] = value
+				break
+			}
+		}
+	}
+	for name, value := range e.SetEnv {
+		vars[name] = value
+	}
+
+	environ := make([]string, 0, len(vars))
+	for name, value := range vars {
+		environ = append(environ, name+"="+value)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// ParseEnvVar splits a KEY=VALUE pair, the value may be empty
+func ParseEnvVar(kv string) (string, string, error) {
+	name, value, ok := strings.Cut(kv, "=")
+	if !ok || name == "" {
+		return "", "", errors.Errorf("invalid environment variable %q, expect KEY=VALUE", kv)
+	}
+	return name, value, nil
+}
+
+// ValidateSendEnv checks the name pattern of local environment variables to send,
+// '*' and '?' wildcards are supported
+func ValidateSendEnv(pattern string) error {
+	if pattern == "" || strings.Contains(pattern, "=") {
+		return errors.Errorf("invalid environment variable name %q", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return errors.Wrapf(err, "invalid environment variable pattern %q", pattern)
+	}
+	return nil
+}
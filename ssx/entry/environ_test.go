@@ -0,0 +1,52 @@
+package entry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntry_Environ(t *testing.T) {
+	t.Setenv("LC_ALL", "C")
+	t.Setenv("LC_TIME", "en_GB.UTF-8")
+	t.Setenv("HTTP_PROXY", "http://local:3128")
+	e := &Entry{
+		SetEnv:  map[string]string{"LANG": "en_US.UTF-8", "HTTP_PROXY": "http://prod:3128"},
+		SendEnv: []string{"LC_*", "HTTP_PROXY", "NOT_EXIST"},
+	}
+	assert.Equal(t, []string{
+		"HTTP_PROXY=http://prod:3128",
+		"LANG=en_US.UTF-8",
+		"LC_ALL=C",
+		"LC_TIME=en_GB.UTF-8",
+	}, e.Environ())
+	assert.Empty(t, (&Entry{}).Environ())
+}
+
+func TestParseEnvVar(t *testing.T) {
+	name, value, err := ParseEnvVar("KUBECONFIG=/etc/kube/a=b")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "KUBECONFIG", name)
+	assert.Equal(t, "/etc/kube/a=b", value)
+
+	_, value, err = ParseEnvVar("EMPTY=")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "", value)
+
+	for _, kv := range []string{"LANG", "=value", ""} {
+		_, _, err = ParseEnvVar(kv)
+		assert.Error(t, err, kv)
+	}
+}
+
+func TestValidateSendEnv(t *testing.T) {
+	assert.NoError(t, ValidateSendEnv("LC_*"))
+	assert.NoError(t, ValidateSendEnv("LANG"))
+	assert.Error(t, ValidateSendEnv(""))
+	assert.Error(t, ValidateSendEnv("A=B"))
+	assert.Error(t, ValidateSendEnv("LC_["))
+}
@@ -0,0 +1,201 @@
+package entry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/skeema/knownhosts"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/terminal"
+	"github.com/vimiix/ssx/internal/utils"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+// Host key checking policies, similar to StrictHostKeyChecking of OpenSSH
+const (
+	HostKeyPolicyStrict    = "strict"     // only known hosts are allowed
+	HostKeyPolicyAsk       = "ask"        // confirm the fingerprint of unknown hosts interactively
+	HostKeyPolicyAcceptNew = "accept-new" // add unknown hosts to known_hosts silently
+	HostKeyPolicyOff       = "off"        // no verification at all
+)
+
+// ErrHostKeyVerification is wrapped by all errors of rejected host keys
+var ErrHostKeyVerification = errors.New("host key verification failed")
+
+const (
+	defaultHostKeyPolicy  = HostKeyPolicyAcceptNew
+	defaultKnownHostsFile = "~/.ssh/known_hosts"
+)
+
+// ValidateHostKeyPolicy checks if policy is a supported host key policy,
+// empty policy is valid and means the global setting.
+func ValidateHostKeyPolicy(policy string) error {
+	switch policy {
+	case "", HostKeyPolicyStrict, HostKeyPolicyAsk, HostKeyPolicyAcceptNew, HostKeyPolicyOff:
+		return nil
+	default:
+		return errors.Errorf("invalid host key policy %q, expect one of: %s", policy,
+			strings.Join([]string{HostKeyPolicyStrict, HostKeyPolicyAsk, HostKeyPolicyAcceptNew, HostKeyPolicyOff}, ", "))
+	}
+}
+
+// hostKeyOption holds the host key verification settings of a single hop
+type hostKeyOption struct {
+	policy         string
+	knownHostsFile string
+	fingerprint    string // pinned SHA256 fingerprint
+}
+
+// resolvePolicy returns the effective policy,
+// the hop setting takes precedence over the global one.
+func (o *hostKeyOption) resolvePolicy() string {
+	if o.policy != "" {
+		return o.policy
+	}
+	if val := os.Getenv(env.SSXHostKeyPolicy); val != "" {
+		if err := ValidateHostKeyPolicy(val); err != nil {
+			lg.Warn("ignore %s: %s", env.SSXHostKeyPolicy, err)
+		} else {
+			return val
+		}
+	}
+	return defaultHostKeyPolicy
+}
+
+func (o *hostKeyOption) knownHostsPath() string {
+	file := o.knownHostsFile
+	if file == "" {
+		file = os.Getenv(env.SSXKnownHostsFile)
+	}
+	if file == "" {
+		file = defaultKnownHostsFile
+	}
+	return utils.ExpandHomeDir(file)
+}
+
+// ValidateFingerprint checks if fp looks like a SHA256 fingerprint of ssh key
+func ValidateFingerprint(fp string) error {
+	if fp == "" {
+		return nil
+	}
+	if !strings.HasPrefix(fp, "SHA256:") || len(fp) != len("SHA256:")+43 {
+		return errors.Errorf("invalid fingerprint %q, expect the SHA256:... format of ssh-keygen -lf", fp)
+	}
+	return nil
+}
+
+func ensureFile(file string) error {
+	if utils.FileExists(file) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (o *hostKeyOption) callback(ctx context.Context) (ssh.HostKeyCallback, error) {
+	policy := o.resolvePolicy()
+	khPath := o.knownHostsPath()
+	lg.Debug("host key policy: %s, known_hosts: %s", policy, khPath)
+	if err := ensureFile(khPath); err != nil {
+		return nil, err
+	}
+	kh, err := knownhosts.New(khPath)
+	if err != nil {
+		lg.Error("failed to read known_hosts: %s", err)
+		return nil, err
+	}
+
+	cb := ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if o.fingerprint != "" {
+			// the pinned fingerprint is trusted more than known_hosts
+			if fp := ssh.FingerprintSHA256(key); fp != o.fingerprint {
+				lg.Error("host key fingerprint of %s is %s, but %s is pinned! This may indicate a MitM attack.",
+					hostname, fp, o.fingerprint)
+				return errors.Wrapf(ErrHostKeyVerification, "fingerprint mismatch for host %s", hostname)
+			}
+			lg.Debug("host key of %s matches the pinned fingerprint", hostname)
+			return nil
+		}
+		err := kh(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+		if policy == HostKeyPolicyOff {
+			lg.Debug("host key checking is off, accept host %s: %s", hostname, err)
+			return nil
+		}
+		if knownhosts.IsHostKeyChanged(err) {
+			lg.Error("REMOTE HOST IDENTIFICATION HAS CHANGED for host %s! This may indicate a MitM attack.", hostname)
+			return errors.Wrapf(ErrHostKeyVerification, "host key changed for host %s", hostname)
+		}
+		if !knownhosts.IsHostUnknown(err) {
+			return errors.Wrapf(ErrHostKeyVerification, "%s", err)
+		}
+
+		switch policy {
+		case HostKeyPolicyStrict:
+			return errors.Wrapf(ErrHostKeyVerification, "%s key of host %s is unknown (fingerprint %s)",
+				key.Type(), hostname, ssh.FingerprintSHA256(key))
+		case HostKeyPolicyAsk:
+			ok, askErr := confirmHostKey(ctx, hostname, remote, key)
+			if askErr != nil {
+				return askErr
+			}
+			if !ok {
+				return errors.Wrapf(ErrHostKeyVerification, "host %s is not trusted", hostname)
+			}
+		}
+		addKnownHost(khPath, hostname, remote, key)
+		return nil
+	})
+	return cb, nil
+}
+
+func addKnownHost(khPath string, hostname string, remote net.Addr, key ssh.PublicKey) {
+	f, err := os.OpenFile(khPath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err == nil {
+		defer f.Close()
+		err = knownhosts.WriteKnownHost(f, hostname, remote, key)
+	}
+	if err == nil {
+		lg.Info("added host %s to %s", hostname, khPath)
+	} else {
+		lg.Warn("failed to add host %s to %s: %v", hostname, khPath, err)
+	}
+}
+
+func confirmHostKey(ctx context.Context, hostname string, remote net.Addr, key ssh.PublicKey) (bool, error) {
+	if err := terminal.CheckPrompt(ctx); err != nil {
+		return false, err
+	}
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	fmt.Printf("The authenticity of host '%s (%s)' can't be established.\n", hostname, remote)
+	fmt.Printf("%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+	for {
+		fmt.Print("Are you sure you want to continue connecting (yes/no)? ")
+		answer, err := terminal.ReadLine(ctx)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "yes", "y":
+			return true, nil
+		case "no", "n":
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package entry
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	return key
+}
+
+func TestHostKeyOption_callback(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		hostname = "192.168.1.100:2222"
+		remote   = &net.TCPAddr{IP: net.ParseIP("192.168.1.100"), Port: 2222}
+		key      = newTestHostKey(t)
+		otherKey = newTestHostKey(t)
+		khPath   = filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	)
+
+	strict, err := (&hostKeyOption{policy: HostKeyPolicyStrict, knownHostsFile: khPath}).callback(ctx)
+	assert.NoError(t, err)
+	assert.Error(t, strict(hostname, remote, key), "unknown host should be rejected in strict mode")
+
+	acceptNew, err := (&hostKeyOption{policy: HostKeyPolicyAcceptNew, knownHostsFile: khPath}).callback(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, acceptNew(hostname, remote, key))
+	bs, _ := os.ReadFile(khPath)
+	assert.Contains(t, string(bs), "[192.168.1.100]:2222")
+
+	// reload known_hosts
+	strict, err = (&hostKeyOption{policy: HostKeyPolicyStrict, knownHostsFile: khPath}).callback(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, strict(hostname, remote, key))
+	assert.Error(t, strict(hostname, remote, otherKey), "changed host key should be rejected")
+
+	off, err := (&hostKeyOption{policy: HostKeyPolicyOff, knownHostsFile: khPath}).callback(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, off(hostname, remote, otherKey))
+}
+
+func TestHostKeyOption_resolvePolicy(t *testing.T) {
+	t.Setenv(env.SSXHostKeyPolicy, "")
+	assert.Equal(t, HostKeyPolicyAcceptNew, (&hostKeyOption{}).resolvePolicy())
+
+	t.Setenv(env.SSXHostKeyPolicy, HostKeyPolicyStrict)
+	assert.Equal(t, HostKeyPolicyStrict, (&hostKeyOption{}).resolvePolicy())
+	assert.Equal(t, HostKeyPolicyAsk, (&hostKeyOption{policy: HostKeyPolicyAsk}).resolvePolicy())
+
+	t.Setenv(env.SSXHostKeyPolicy, "bad")
+	assert.Equal(t, HostKeyPolicyAcceptNew, (&hostKeyOption{}).resolvePolicy())
+}
+
+func TestHostKeyOption_pinnedFingerprint(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		hostname = "192.168.1.100:22"
+		remote   = &net.TCPAddr{IP: net.ParseIP("192.168.1.100"), Port: 22}
+		key      = newTestHostKey(t)
+		khPath   = filepath.Join(t.TempDir(), "known_hosts")
+	)
+	opt := &hostKeyOption{
+		policy:         HostKeyPolicyStrict,
+		knownHostsFile: khPath,
+		fingerprint:    ssh.FingerprintSHA256(key),
+	}
+	cb, err := opt.callback(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, cb(hostname, remote, key))
+	assert.Error(t, cb(hostname, remote, newTestHostKey(t)))
+
+	assert.NoError(t, ValidateFingerprint(opt.fingerprint))
+	assert.Error(t, ValidateFingerprint("MD5:aa:bb"))
+}
@@ -12,11 +12,18 @@ import (
 // Proxy represents a jump server
 // Usage example: ssx -J <jump server1>[,<jump server2>,<jump server3>] <remote server>
 type Proxy struct {
-	Host     string `json:"host"`
-	User     string `json:"user"`
-	Port     string `json:"port"`
-	Password string `json:"password"`
-	Proxy    *Proxy `json:"proxy"`
+	Host            string `json:"host"`
+	User            string `json:"user"`
+	Port            string `json:"port"`
+	Password        string `json:"password"`
+	Proxy           *Proxy `json:"proxy"`
+	DisableAgent    bool   `json:"disable_agent"` // do not authenticate through the running ssh-agent
+	TOTPSecret      string `json:"totp_secret"`   // base32 seed to answer verification code questions
+	KeyPath         string `json:"key_path"`
+	Passphrase      string `json:"passphrase"`
+	CertificateFile string `json:"certificate_file"` // OpenSSH user certificate, <keyfile>-cert.pub is tried as well
+	HostKeyPolicy   string `json:"host_key_policy"`  // one of strict, ask, accept-new and off, empty means global setting
+	KnownHostsFile  string `json:"known_hosts_file"` // empty means global setting
 }
 
 func (p *Proxy) Mask() {
@@ -24,6 +31,8 @@ func (p *Proxy) Mask() {
 		return
 	}
 	p.Password = utils.MaskString(p.Password)
+	p.Passphrase = utils.MaskString(p.Passphrase)
+	p.TOTPSecret = utils.MaskString(p.TOTPSecret)
 	if p.Proxy != nil {
 		p.Proxy.Mask()
 	}
@@ -50,30 +59,54 @@ func (p *Proxy) String() string {
 }
 
 func (p *Proxy) GenSSHConfig(ctx context.Context) (*ssh.ClientConfig, error) {
-	cb, err := sshHostKeyCallback()
+	cb, err := p.hostKeyOption().callback(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var auth []ssh.AuthMethod
-	if p.Password != "" {
-		auth = append(auth, ssh.Password(p.Password))
-	} else {
-		auth = append(auth, passwordCallback(
-			ctx, p.User, p.Host, func(password string) { p.Password = password },
-		))
+	auth, err := p.credential().authMethods(ctx)
+	if err != nil {
+		return nil, err
 	}
 	cfg := &ssh.ClientConfig{
 		User:            p.User,
 		Auth:            auth,
 		HostKeyCallback: cb,
-		Timeout:         getConnectTimeout(),
+		Timeout:         ConnectTimeout(),
 	}
 	return cfg, nil
 }
 
+func (p *Proxy) credential() *credential {
+	return &credential{
+		user:         p.User,
+		host:         p.Host,
+		keyPath:      p.KeyPath,
+		certFile:     p.CertificateFile,
+		totpSecret:   p.TOTPSecret,
+		disableAgent: p.DisableAgent,
+		password:     &p.Password,
+		passphrase:   &p.Passphrase,
+	}
+}
+
+func (p *Proxy) hostKeyOption() *hostKeyOption {
+	return &hostKeyOption{
+		policy:         p.HostKeyPolicy,
+		knownHostsFile: p.KnownHostsFile,
+	}
+}
+
 func (p *Proxy) ClearPassword() {
 	p.Password = ""
 	if p.Proxy != nil {
 		p.Proxy.ClearPassword()
 	}
 }
+
+// SetDisableAgent switches ssh-agent authentication for this hop and all following hops
+func (p *Proxy) SetDisableAgent(disable bool) {
+	p.DisableAgent = disable
+	if p.Proxy != nil {
+		p.Proxy.SetDisableAgent(disable)
+	}
+}
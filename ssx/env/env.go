@@ -6,12 +6,23 @@ import (
 )
 
 const (
-	SSXDBPath          = "SSX_DB_PATH"
-	SSXConnectTimeout  = "SSX_CONNECT_TIMEOUT"
-	SSXImportSSHConfig = "SSX_IMPORT_SSH_CONFIG" // 设置了该环境变量的话，就会自动将 ~/.ssh/config 中的条目也加载
-	SSXUnsafeMode      = "SSX_UNSAFE_MODE"       // deprecated
-	SSXSecretKey       = "SSX_SECRET_KEY"        // deprecated, replaced by SSX_DEVICE_ID
-	SSXDeviceID        = "SSX_DEVICE_ID"
+	SSXDBPath            = "SSX_DB_PATH"
+	SSXConnectTimeout    = "SSX_CONNECT_TIMEOUT"
+	SSXImportSSHConfig   = "SSX_IMPORT_SSH_CONFIG" // 设置了该环境变量的话，就会自动将 ~/.ssh/config 中的条目也加载
+	SSXUnsafeMode        = "SSX_UNSAFE_MODE"       // deprecated
+	SSXSecretKey         = "SSX_SECRET_KEY"        // deprecated, replaced by SSX_DEVICE_ID
+	SSXDeviceID          = "SSX_DEVICE_ID"
+	SSXHostKeyPolicy     = "SSX_HOST_KEY_POLICY" // strict, ask, accept-new or off
+	SSXKnownHostsFile    = "SSX_KNOWN_HOSTS_FILE"
+	SSXMux               = "SSX_MUX" // share connections through a background master if set
+	SSXMuxIdleTimeout    = "SSX_MUX_IDLE_TIMEOUT"
+	SSXRecordDir         = "SSX_RECORD_DIR"    // directory of session recordings, ~/.ssx/recordings by default
+	SSXNoHistory         = "SSX_NO_HISTORY"    // do not save connection history if set
+	SSXHistoryLimit      = "SSX_HISTORY_LIMIT" // the oldest history records beyond it are deleted, 0 means no limit
+	SSXKeepaliveInterval = "SSX_KEEPALIVE_INTERVAL"
+	SSXKeepaliveCount    = "SSX_KEEPALIVE_COUNT" // connection is considered lost after so many keepalives not replied
+
+	SSHAuthSock = "SSH_AUTH_SOCK" // unix socket of the running ssh-agent
 )
 
 func IsUnsafeMode() bool {
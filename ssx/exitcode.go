@@ -0,0 +1,117 @@
+package ssx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+// Exit codes of ssx itself, the exit status of remote command is passed
+// through as is, and 128+signum if the remote command was killed by signal.
+const (
+	ExitCodeError      = 1   // local error, such as invalid arguments
+	ExitCodeTimeout    = 124 // command timed out by --timeout, same as timeout(1)
+	ExitCodeHostKey    = 253 // host key verification failed
+	ExitCodeAuth       = 254 // authentication failed
+	ExitCodeConnection = 255 // failed to connect or connection lost, same as ssh
+)
+
+// signalNumbers maps signal names of RFC 4254 to their common numbers
+var signalNumbers = map[string]int{
+	"HUP":  1,
+	"INT":  2,
+	"QUIT": 3,
+	"ILL":  4,
+	"ABRT": 6,
+	"FPE":  8,
+	"KILL": 9,
+	"USR1": 10,
+	"SEGV": 11,
+	"USR2": 12,
+	"PIPE": 13,
+	"ALRM": 14,
+	"TERM": 15,
+}
+
+// connectError is returned if failed to connect or login remote server
+type connectError struct {
+	err error
+}
+
+func (e *connectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connectError) Unwrap() error {
+	return e.err
+}
+
+// timeoutError is returned if the command was terminated by timeout
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %s: %s", e.timeout, e.err)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+// IsRemoteExit reports whether err only carries the exit status of
+// remote command, which is not necessary to be printed
+func IsRemoteExit(err error) bool {
+	var (
+		exitErr    *ssh.ExitError
+		timeoutErr *timeoutError
+	)
+	return errors.As(err, &exitErr) && !errors.As(err, &timeoutErr)
+}
+
+// ExitCode returns the exit code of ssx for err returned by commands
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var (
+		exitErr    *ssh.ExitError
+		missingErr *ssh.ExitMissingError
+		connErr    *connectError
+		sigCause   *SignalCause
+		timeoutErr *timeoutError
+	)
+	switch {
+	case errors.As(err, &timeoutErr):
+		return ExitCodeTimeout
+	case errors.As(err, &exitErr):
+		return remoteExitCode(exitErr.ExitStatus(), exitErr.Signal())
+	case errors.As(err, &sigCause):
+		// ssx itself was interrupted
+		return remoteExitCode(-1, string(sigCause.Signal))
+	case errors.Is(err, entry.ErrHostKeyVerification):
+		return ExitCodeHostKey
+	case errors.Is(err, ErrAuthentication):
+		return ExitCodeAuth
+	case errors.As(err, &connErr), errors.As(err, &missingErr):
+		return ExitCodeConnection
+	default:
+		return ExitCodeError
+	}
+}
+
+// remoteExitCode converts exit status or signal of remote command to exit code
+func remoteExitCode(status int, signal string) int {
+	if signal == "" {
+		return status
+	}
+	if num, ok := signalNumbers[signal]; ok {
+		return 128 + num
+	}
+	return ExitCodeConnection
+}
@@ -0,0 +1,40 @@
+package ssx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, ExitCodeError, ExitCode(errors.New("invalid argument")))
+	assert.Equal(t, ExitCodeConnection, ExitCode(&connectError{err: errors.New("dial tcp: connection refused")}))
+	assert.Equal(t, ExitCodeAuth, ExitCode(&connectError{
+		err: &authError{host: "root@10.0.0.1:22", err: errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password], no supported methods remain")},
+	}))
+	assert.Equal(t, ExitCodeError, ExitCode(errors.New("ssh: unable to authenticate")))
+	assert.Equal(t, ExitCodeHostKey, ExitCode(&connectError{
+		err: errors.Wrap(errors.Wrapf(entry.ErrHostKeyVerification, "host key changed for host %s", "h"), "ssh: handshake failed"),
+	}))
+	assert.Equal(t, 130, ExitCode(errors.Wrap(&SignalCause{Signal: ssh.SIGINT}, "session closed")))
+
+	timeout := &timeoutError{timeout: time.Second, err: errors.Wrap(context.DeadlineExceeded, "session closed")}
+	assert.Equal(t, ExitCodeTimeout, ExitCode(timeout))
+	assert.Equal(t, ExitCodeTimeout, ExitCode(&timeoutError{timeout: time.Second, err: &ssh.ExitError{}}))
+	assert.False(t, IsRemoteExit(&timeoutError{timeout: time.Second, err: &ssh.ExitError{}}))
+	assert.Equal(t, "command timed out after 1s: session closed: context deadline exceeded", timeout.Error())
+}
+
+func TestRemoteExitCode(t *testing.T) {
+	assert.Equal(t, 3, remoteExitCode(3, ""))
+	assert.Equal(t, 130, remoteExitCode(-1, "INT"))
+	assert.Equal(t, 137, remoteExitCode(-1, "KILL"))
+	assert.Equal(t, ExitCodeConnection, remoteExitCode(-1, "UNKNOWN"))
+}
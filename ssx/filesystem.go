@@ -0,0 +1,720 @@
+package ssx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	scp "github.com/bramvdbogaerde/go-scp"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/utils"
+)
+
+// Transfer protocols of cp
+const (
+	ProtocolSFTP = "sftp"
+	ProtocolSCP  = "scp"
+)
+
+// fileSystem is the file system of either side of cp
+type fileSystem interface {
+	Stat(p string) (os.FileInfo, error)
+	Lstat(p string) (os.FileInfo, error)
+	// ReadDir returns the entries of directory without following symlinks
+	ReadDir(p string) ([]os.FileInfo, error)
+	ReadLink(p string) (string, error)
+	Symlink(target, link string) error
+	MkdirAll(p string) error
+	Chmod(p string, mode os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(p string) error
+	// Open opens the file for streaming read
+	Open(p string) (io.ReadCloser, error)
+	// OpenAt opens the file for streaming read from offset
+	OpenAt(p string, offset int64) (io.ReadCloser, error)
+	// Create creates or truncates the file for streaming write,
+	// size is the length of content to write, which is required by scp
+	Create(p string, mode os.FileMode, size int64) (io.WriteCloser, error)
+	// Append opens the existing file for streaming write at its end
+	Append(p string) (io.WriteCloser, error)
+	// Sum returns the hex encoded SHA-256 checksum of the first n bytes
+	// of the file, or the whole file if n is negative
+	Sum(p string, n int64) (string, error)
+	// Glob returns the paths matching pattern, which is expanded on the server for remote
+	Glob(pattern string) ([]string, error)
+	Join(elem ...string) string
+	Close() error
+}
+
+// newRemoteFS opens the remote file system over cli with protocol
+func newRemoteFS(ctx context.Context, cli *ssh.Client, protocol string) (fileSystem, error) {
+	switch protocol {
+	case "", ProtocolSFTP:
+		c, err := sftp.NewClient(cli, sftp.UseConcurrentWrites(true))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to start sftp, try '--protocol scp' if the server does not support it")
+		}
+		return &sftpFS{cli: cli, c: c}, nil
+	case ProtocolSCP:
+		c, err := scp.NewClientBySSH(cli)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create SCP client")
+		}
+		return &scpFS{ctx: ctx, cli: cli, c: c}, nil
+	default:
+		return nil, errors.Errorf("unsupported protocol %q, expect %s or %s", protocol, ProtocolSFTP, ProtocolSCP)
+	}
+}
+
+// localFS is the local file system
+type localFS struct{}
+
+func (localFS) Stat(p string) (os.FileInfo, error)  { return os.Stat(p) }
+func (localFS) Lstat(p string) (os.FileInfo, error) { return os.Lstat(p) }
+
+func (localFS) ReadDir(p string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localFS) ReadLink(p string) (string, error)      { return os.Readlink(p) }
+func (localFS) Symlink(target, link string) error      { return os.Symlink(target, link) }
+func (localFS) MkdirAll(p string) error                { return os.MkdirAll(p, 0755) }
+func (localFS) Chmod(p string, mode os.FileMode) error { return os.Chmod(p, mode) }
+func (localFS) Rename(oldpath, newpath string) error   { return os.Rename(oldpath, newpath) }
+func (localFS) Remove(p string) error                  { return os.Remove(p) }
+func (localFS) Open(p string) (io.ReadCloser, error)   { return os.Open(p) }
+func (localFS) Glob(pattern string) ([]string, error)  { return filepath.Glob(pattern) }
+func (localFS) Join(elem ...string) string             { return filepath.Join(elem...) }
+func (localFS) Close() error                           { return nil }
+
+func (localFS) OpenAt(p string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (localFS) Append(p string) (io.WriteCloser, error) {
+	return os.OpenFile(p, os.O_WRONLY|os.O_APPEND, 0)
+}
+
+func (localFS) Sum(p string, n int64) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return sumReader(f, n)
+}
+
+func (localFS) Create(p string, mode os.FileMode, _ int64) (io.WriteCloser, error) {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return nil, err
+	}
+	// the mode of existing file is not changed by OpenFile
+	if err = f.Chmod(mode.Perm()); err != nil {
+		lg.Debug("failed to chmod %s: %s", p, err)
+	}
+	return f, nil
+}
+
+// relativeToHome converts path starting with ~/ to the one relative to
+// the home directory, which is the working directory of sftp and shell
+func relativeToHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	if p = strings.TrimLeft(strings.TrimPrefix(p, "~"), "/"); p == "" {
+		return "."
+	}
+	return p
+}
+
+type sftpFS struct {
+	cli *ssh.Client // for commands out of sftp
+	c   *sftp.Client
+}
+
+func (s *sftpFS) Stat(p string) (os.FileInfo, error) {
+	return s.c.Stat(relativeToHome(p))
+}
+
+func (s *sftpFS) Lstat(p string) (os.FileInfo, error) {
+	return s.c.Lstat(relativeToHome(p))
+}
+
+func (s *sftpFS) ReadDir(p string) ([]os.FileInfo, error) {
+	return s.c.ReadDir(relativeToHome(p))
+}
+
+func (s *sftpFS) ReadLink(p string) (string, error) {
+	return s.c.ReadLink(relativeToHome(p))
+}
+
+func (s *sftpFS) Symlink(target, link string) error {
+	return s.c.Symlink(target, relativeToHome(link))
+}
+
+func (s *sftpFS) MkdirAll(p string) error {
+	return s.c.MkdirAll(relativeToHome(p))
+}
+
+func (s *sftpFS) Chmod(p string, mode os.FileMode) error {
+	return s.c.Chmod(relativeToHome(p), mode)
+}
+
+func (s *sftpFS) Rename(oldpath, newpath string) error {
+	// rename of sftp v3 fails if newpath exists, use the openssh extension if supported
+	if _, ok := s.c.HasExtension("posix-rename@openssh.com"); ok {
+		return s.c.PosixRename(relativeToHome(oldpath), relativeToHome(newpath))
+	}
+	// not atomic, but the target is replaced only after the new file is complete
+	oldpath, newpath = relativeToHome(oldpath), relativeToHome(newpath)
+	if _, err := s.c.Lstat(newpath); err == nil {
+		if err = s.c.Remove(newpath); err != nil {
+			return err
+		}
+	}
+	return s.c.Rename(oldpath, newpath)
+}
+
+func (s *sftpFS) Remove(p string) error {
+	return s.c.Remove(relativeToHome(p))
+}
+
+func (s *sftpFS) Open(p string) (io.ReadCloser, error) {
+	return s.c.Open(relativeToHome(p))
+}
+
+func (s *sftpFS) OpenAt(p string, offset int64) (io.ReadCloser, error) {
+	f, err := s.c.Open(relativeToHome(p))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *sftpFS) Append(p string) (io.WriteCloser, error) {
+	// O_APPEND is not honored by all servers, write at the end explicitly
+	f, err := s.c.OpenFile(relativeToHome(p), os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Sum computes the checksum on the server if possible, otherwise
+// the file is read over sftp and hashed locally
+func (s *sftpFS) Sum(p string, n int64) (string, error) {
+	sum, err := remoteSum(s.cli, p, n)
+	if err == nil {
+		return sum, nil
+	}
+	lg.Debug("%s, read the file over sftp instead", err)
+	f, err := s.c.Open(relativeToHome(p))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return sumReader(f, n)
+}
+
+func (s *sftpFS) Create(p string, mode os.FileMode, _ int64) (io.WriteCloser, error) {
+	p = relativeToHome(p)
+	f, err := s.c.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Chmod(mode.Perm()); err != nil {
+		lg.Debug("failed to chmod %s: %s", p, err)
+	}
+	return f, nil
+}
+
+func (s *sftpFS) Glob(pattern string) ([]string, error) {
+	// matched by listing directories over sftp, no shell is involved
+	matches, err := s.c.Glob(relativeToHome(pattern))
+	if err != nil {
+		return nil, err
+	}
+	// like the shell, hidden files are matched only if the pattern starts with a dot
+	if strings.HasPrefix(path.Base(pattern), ".") {
+		return matches, nil
+	}
+	visible := matches[:0]
+	for _, m := range matches {
+		if !strings.HasPrefix(path.Base(m), ".") {
+			visible = append(visible, m)
+		}
+	}
+	return visible, nil
+}
+
+func (s *sftpFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (s *sftpFS) Close() error {
+	return s.c.Close()
+}
+
+// scpFS transfers files by scp, and inspects files by shell commands,
+// which requires a POSIX shell on the server
+type scpFS struct {
+	ctx context.Context
+	cli *ssh.Client
+	c   scp.Client
+}
+
+// run executes command and returns its stdout
+func (s *scpFS) run(cmd string) (string, error) {
+	return runRemote(s.cli, cmd)
+}
+
+// runRemote executes command on cli and returns its stdout,
+// the error message is taken from stderr if any
+func runRemote(cli *ssh.Client, cmd string) (string, error) {
+	sess, err := cli.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer sess.Close()
+	lg.Debug("remote command: %s", cmd)
+	var stderr bytes.Buffer
+	sess.Stderr = &stderr
+	out, err := sess.Output(cmd)
+	if err != nil {
+		return "", stderrError(err, &stderr)
+	}
+	return string(out), nil
+}
+
+// sumReader returns the hex encoded SHA-256 checksum of the first n bytes of r,
+// or all of it if n is negative
+func sumReader(r io.Reader, n int64) (string, error) {
+	if n >= 0 {
+		r = io.LimitReader(r, n)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func stderrError(err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// remoteSum returns the SHA-256 checksum of the first n bytes of remote file,
+// or the whole file if n is negative, by sha256sum, or shasum on systems like
+// macOS and FreeBSD. It fails if the server has no shell or neither of them.
+func remoteSum(cli *ssh.Client, p string, n int64) (string, error) {
+	q := utils.ShellQuote(relativeToHome(p))
+	hasher := "if command -v sha256sum >/dev/null 2>&1; then sha256sum; else shasum -a 256; fi"
+	cmd := hasher + " < " + q
+	if n >= 0 {
+		// the file is checked first, as the failure of head is hidden by the pipe
+		cmd = fmt.Sprintf("[ -r %[1]s ] || exit 1; head -c %[2]d < %[1]s | %[3]s", q, n, hasher)
+	}
+	out, err := runRemote(cli, cmd)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to compute checksum on remote host")
+	}
+	// the output is "<checksum>  -"
+	sum, _, _ := strings.Cut(strings.TrimSpace(out), " ")
+	if len(sum) != sha256.Size*2 {
+		return "", errors.Errorf("unexpected checksum output: %q", out)
+	}
+	return sum, nil
+}
+
+func (s *scpFS) Stat(p string) (os.FileInfo, error) {
+	return s.stat(p, true)
+}
+
+func (s *scpFS) Lstat(p string) (os.FileInfo, error) {
+	return s.stat(p, false)
+}
+
+func (s *scpFS) stat(p string, follow bool) (os.FileInfo, error) {
+	q := utils.ShellQuote(relativeToHome(p))
+	flag := ""
+	if follow {
+		flag = "-L "
+	}
+	// size, raw mode in hex and modification time, by GNU or BSD stat
+	out, err := s.run(fmt.Sprintf(`stat %[1]s-c '%%s %%f %%Y' %[2]s 2>/dev/null || stat %[1]s-f '%%z %%Xp %%m' %[2]s 2>/dev/null || echo -`, flag, q))
+	if err != nil {
+		return nil, err
+	}
+	out = strings.TrimSpace(out)
+	if out == "-" {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return parseStatOutput(path.Base(p), out)
+}
+
+// parseStatOutput parses "<size> <hex raw mode> <mtime>" into file info
+func parseStatOutput(name, out string) (os.FileInfo, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 3 {
+		return nil, errors.Errorf("unexpected stat output: %q", out)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("unexpected stat output: %q", out)
+	}
+	raw, err := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil {
+		return nil, errors.Errorf("unexpected stat output: %q", out)
+	}
+	mtime, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("unexpected stat output: %q", out)
+	}
+	return &remoteFileInfo{
+		name:    name,
+		size:    size,
+		mode:    (&sftp.FileStat{Mode: uint32(raw)}).FileMode(),
+		modTime: time.Unix(mtime, 0),
+	}, nil
+}
+
+func (s *scpFS) ReadDir(p string) ([]os.FileInfo, error) {
+	// names are separated by NUL, which is the only byte not allowed in them
+	out, err := s.run(fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 -print0", utils.ShellQuote(relativeToHome(p))))
+	if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	for _, child := range strings.Split(out, "\x00") {
+		if child == "" {
+			continue
+		}
+		info, err := s.Lstat(child)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *scpFS) ReadLink(p string) (string, error) {
+	out, err := s.run("readlink " + utils.ShellQuote(relativeToHome(p)))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out, "\n"), nil
+}
+
+func (s *scpFS) Symlink(target, link string) error {
+	_, err := s.run(fmt.Sprintf("ln -s %s %s", utils.ShellQuote(target), utils.ShellQuote(relativeToHome(link))))
+	return err
+}
+
+func (s *scpFS) MkdirAll(p string) error {
+	_, err := s.run("mkdir -p " + utils.ShellQuote(relativeToHome(p)))
+	return err
+}
+
+func (s *scpFS) Chmod(p string, mode os.FileMode) error {
+	_, err := s.run(fmt.Sprintf("chmod %04o %s", mode.Perm(), utils.ShellQuote(relativeToHome(p))))
+	return err
+}
+
+func (s *scpFS) Rename(oldpath, newpath string) error {
+	_, err := s.run(fmt.Sprintf("mv -f %s %s",
+		utils.ShellQuote(relativeToHome(oldpath)), utils.ShellQuote(relativeToHome(newpath))))
+	return err
+}
+
+func (s *scpFS) Remove(p string) error {
+	_, err := s.run("rm -f " + utils.ShellQuote(relativeToHome(p)))
+	return err
+}
+
+// checkSCPPath rejects paths which can not be passed to scp as-is, go-scp
+// puts the path in the remote command with Go quoting, in which the shell
+// still expands '$' and '`', and escapes like \n are not understood
+func checkSCPPath(p string) error {
+	if strings.ContainsAny(p, "$`") || strconv.Quote(p) != `"`+strings.ReplaceAll(p, `"`, `\"`)+`"` {
+		return errors.Errorf("path %q is not supported by scp, use sftp instead", p)
+	}
+	return nil
+}
+
+func (s *scpFS) Open(p string) (io.ReadCloser, error) {
+	if err := checkSCPPath(p); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.c.CopyFromRemotePassThru(s.ctx, pw, relativeToHome(p), nil)
+		_ = pw.CloseWithError(err)
+	}()
+	return &pipeCloser{PipeReader: pr, done: done}, nil
+}
+
+// OpenAt streams the file from offset by tail, as scp can not
+func (s *scpFS) OpenAt(p string, offset int64) (io.ReadCloser, error) {
+	return s.openCommand(fmt.Sprintf("tail -c +%d %s", offset+1, utils.ShellQuote(relativeToHome(p))))
+}
+
+// Append streams to the end of file by cat, as scp can not
+func (s *scpFS) Append(p string) (io.WriteCloser, error) {
+	sess, err := s.cli.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w := &sessionWriter{sess: sess}
+	sess.Stderr = &w.stderr
+	if w.WriteCloser, err = sess.StdinPipe(); err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+	cmd := "cat >> " + utils.ShellQuote(relativeToHome(p))
+	lg.Debug("remote command: %s", cmd)
+	if err = sess.Start(cmd); err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *scpFS) openCommand(cmd string) (io.ReadCloser, error) {
+	sess, err := s.cli.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	r := &sessionReader{sess: sess}
+	sess.Stderr = &r.stderr
+	if r.stdout, err = sess.StdoutPipe(); err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+	lg.Debug("remote command: %s", cmd)
+	if err = sess.Start(cmd); err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Sum computes the checksum on the server if possible, otherwise
+// the file is read by cat and hashed locally
+func (s *scpFS) Sum(p string, n int64) (string, error) {
+	sum, err := remoteSum(s.cli, p, n)
+	if err == nil {
+		return sum, nil
+	}
+	lg.Debug("%s, read the file by cat instead", err)
+	r, err := s.openCommand("cat " + utils.ShellQuote(relativeToHome(p)))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	return sumReader(r, n)
+}
+
+func (s *scpFS) Create(p string, mode os.FileMode, size int64) (io.WriteCloser, error) {
+	if err := checkSCPPath(p); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	w := &scpWriter{PipeWriter: pw, errCh: make(chan error, 1)}
+	perm := fmt.Sprintf("%04o", mode.Perm())
+	go func() {
+		err := s.c.CopyPassThru(s.ctx, pr, relativeToHome(p), perm, size, nil)
+		// unblock the writer if failed
+		_ = pr.CloseWithError(err)
+		w.errCh <- err
+	}()
+	return w, nil
+}
+
+// Glob expands pattern by the shell, with all but the glob characters quoted
+func (s *scpFS) Glob(pattern string) ([]string, error) {
+	quoted, err := shellGlob(relativeToHome(pattern))
+	if err != nil {
+		return nil, err
+	}
+	// unmatched pattern is left as is by the shell, which does not exist
+	out, err := s.run(`for f in ` + quoted + `; do if [ -e "$f" ] || [ -L "$f" ]; then printf '%s\0' "$f"; fi; done`)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, m := range strings.Split(out, "\x00") {
+		if m != "" {
+			matches = append(matches, m)
+		}
+	}
+	return matches, nil
+}
+
+// bracketRegex matches the content of bracket expression which is safe to leave unquoted
+var bracketRegex = regexp.MustCompile(`^[!^]?[\w.-]+$`)
+
+// shellGlob quotes pattern for the shell, leaving *, ? and [...] unquoted
+func shellGlob(pattern string) (string, error) {
+	var (
+		b       strings.Builder
+		literal strings.Builder
+	)
+	flush := func() {
+		if literal.Len() > 0 {
+			b.WriteString(utils.ShellQuote(literal.String()))
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*', '?':
+			flush()
+			b.WriteByte(c)
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 || !bracketRegex.MatchString(pattern[i+1:i+1+end]) {
+				return "", errors.Errorf("unsupported glob pattern %q", pattern)
+			}
+			flush()
+			b.WriteString(pattern[i : i+end+2])
+			i += end + 1
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+	return b.String(), nil
+}
+
+func (s *scpFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (s *scpFS) Close() error {
+	return nil
+}
+
+// pipeCloser waits for the writing side to stop after closed
+type pipeCloser struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+func (p *pipeCloser) Close() error {
+	err := p.PipeReader.Close()
+	<-p.done
+	return err
+}
+
+// scpWriter returns the result of scp when closed
+type scpWriter struct {
+	*io.PipeWriter
+	errCh chan error
+}
+
+func (w *scpWriter) Close() error {
+	_ = w.PipeWriter.Close()
+	return <-w.errCh
+}
+
+// sessionReader reads stdout of the command, which fails at the end if the command fails
+type sessionReader struct {
+	sess   *ssh.Session
+	stdout io.Reader
+	stderr bytes.Buffer
+}
+
+func (r *sessionReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := r.sess.Wait(); waitErr != nil {
+			return n, stderrError(waitErr, &r.stderr)
+		}
+	}
+	return n, err
+}
+
+func (r *sessionReader) Close() error {
+	return r.sess.Close()
+}
+
+// sessionWriter writes stdin of the command, and returns its result when closed
+type sessionWriter struct {
+	io.WriteCloser
+	sess   *ssh.Session
+	stderr bytes.Buffer
+}
+
+func (w *sessionWriter) Close() error {
+	defer w.sess.Close()
+	_ = w.WriteCloser.Close()
+	if err := w.sess.Wait(); err != nil {
+		return stderrError(err, &w.stderr)
+	}
+	return nil
+}
+
+// remoteFileInfo implements os.FileInfo with the output of stat command
+type remoteFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *remoteFileInfo) Name() string       { return fi.name }
+func (fi *remoteFileInfo) Size() int64        { return fi.size }
+func (fi *remoteFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *remoteFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *remoteFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *remoteFileInfo) Sys() any           { return nil }
@@ -0,0 +1,201 @@
+package ssx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatOutput(t *testing.T) {
+	fi, err := parseStatOutput("app.log", "1234 81a4 1700000000")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, int64(1234), fi.Size())
+	assert.Equal(t, "-rw-r--r--", fi.Mode().String())
+	assert.False(t, fi.IsDir())
+	assert.Equal(t, int64(1700000000), fi.ModTime().Unix())
+
+	fi, err = parseStatOutput("data", "4096 41ed 1700000000")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.True(t, fi.IsDir())
+	assert.Equal(t, "-rwxr-xr-x", fi.Mode().Perm().String())
+
+	_, err = parseStatOutput("x", "stat: illegal option")
+	assert.Error(t, err)
+}
+
+func TestCheckSCPPath(t *testing.T) {
+	assert.NoError(t, checkSCPPath(`/tmp/a b/it's "quoted".txt`))
+	assert.Error(t, checkSCPPath("/tmp/$HOME"))
+	assert.Error(t, checkSCPPath("/tmp/`id`"))
+	assert.Error(t, checkSCPPath("/tmp/a\nb"))
+}
+
+func TestRelativeToHome(t *testing.T) {
+	assert.Equal(t, ".", relativeToHome("~"))
+	assert.Equal(t, ".", relativeToHome("~/"))
+	assert.Equal(t, "data/a.txt", relativeToHome("~/data/a.txt"))
+	assert.Equal(t, "/tmp/a.txt", relativeToHome("/tmp/a.txt"))
+	assert.Equal(t, "~user/a.txt", relativeToHome("~user/a.txt"))
+}
+
+func TestTreeCopier(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "sub", "run.sh"), []byte("b"), 0o755))
+	assert.NoError(t, os.Symlink("../a.txt", filepath.Join(src, "sub", "link")))
+
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	c := &treeCopier{ctx: context.Background(), src: localFS{}, dst: localFS{}}
+	if err = c.copyDir(src, dst, info, 0); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, 2, c.files)
+	assert.Equal(t, 2, c.dirs)
+	assert.Equal(t, 1, c.links)
+
+	fi, err := os.Stat(filepath.Join(dst, "sub"))
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, os.FileMode(0o700), fi.Mode().Perm())
+	fi, err = os.Stat(filepath.Join(dst, "sub", "run.sh"))
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, os.FileMode(0o755), fi.Mode().Perm())
+	target, err := os.Readlink(filepath.Join(dst, "sub", "link"))
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "../a.txt", target)
+
+	followed := filepath.Join(t.TempDir(), "followed")
+	c = &treeCopier{ctx: context.Background(), src: localFS{}, dst: localFS{}, follow: true}
+	if err = c.copyDir(src, followed, info, 0); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	fi, err = os.Lstat(filepath.Join(followed, "sub", "link"))
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.True(t, fi.Mode().IsRegular())
+}
+
+func TestTreeCopierResume(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	part := dst + partialSuffix
+	assert.NoError(t, os.WriteFile(src, []byte("hello world"), 0o640))
+	assert.NoError(t, os.WriteFile(part, []byte("hello"), 0o600))
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	c := &treeCopier{ctx: context.Background(), src: localFS{}, dst: localFS{}, resume: true, verify: true}
+	assert.Equal(t, int64(5), c.resumeOffset(src, part, info.Size()))
+	if err = c.copyFile(src, dst, info); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	content, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "hello world", string(content))
+	assert.NoFileExists(t, part)
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+	assert.True(t, c.complete(src, dst, info.Size()))
+
+	// the partial file does not match the source
+	assert.NoError(t, os.WriteFile(part, []byte("HELLO"), 0o600))
+	assert.Equal(t, int64(0), c.resumeOffset(src, part, info.Size()))
+
+	// the target of same size does not match the source
+	assert.NoError(t, os.WriteFile(dst, []byte("HELLO WORLD"), 0o600))
+	assert.False(t, c.complete(src, dst, info.Size()))
+	if err = c.copyFile(src, dst, info); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	content, err = os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "hello world", string(content))
+}
+
+func TestTreeCopierFailed(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	assert.NoError(t, os.WriteFile(src, []byte("hello world"), 0o600))
+	assert.NoError(t, os.WriteFile(dst, []byte("old"), 0o600))
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	// the existing target is kept as is, and the partial file is removed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &treeCopier{ctx: ctx, src: localFS{}, dst: localFS{}}
+	assert.Error(t, c.copyFile(src, dst, info))
+	content, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "old", string(content))
+	assert.NoFileExists(t, dst+partialSuffix)
+
+	// the partial file is kept for resuming
+	c.resume = true
+	assert.Error(t, c.copyFile(src, dst, info))
+	assert.FileExists(t, dst+partialSuffix)
+}
+
+func TestLocalFSSum(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "f")
+	assert.NoError(t, os.WriteFile(p, []byte("hello world"), 0o600))
+	sum, err := localFS{}.Sum(p, -1)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", sum)
+	sum, err = localFS{}.Sum(p, 5)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sum)
+}
+
+func TestShellGlob(t *testing.T) {
+	quoted, err := shellGlob("/var/log/it's app/*.log")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, `'/var/log/it'\''s app/'*'.log'`, quoted)
+
+	quoted, err = shellGlob("data-[0-9]?.csv")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, `'data-'[0-9]?'.csv'`, quoted)
+
+	_, err = shellGlob("/tmp/[$(id)]*")
+	assert.Error(t, err)
+	_, err = shellGlob("/tmp/[abc")
+	assert.Error(t, err)
+}
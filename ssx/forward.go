@@ -0,0 +1,381 @@
+package ssx
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/socks5"
+	"github.com/vimiix/ssx/ssx/cleaner"
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+// Endpoint is one end of a forwarding, either a tcp address or a unix socket path
+type Endpoint struct {
+	Network string
+	Address string
+}
+
+func (ep Endpoint) String() string {
+	return ep.Address
+}
+
+// Forward describes a port forwarding,
+// connections accepted on Listen are relayed to Dial
+type Forward struct {
+	Listen Endpoint
+	Dial   Endpoint
+}
+
+func (f *Forward) String() string {
+	return f.Listen.String() + " -> " + f.Dial.String()
+}
+
+// ParseForward parses forwarding spec in ssh -L/-R style:
+//
+//	[bind_address:]port:host:hostport
+//	[bind_address:]port:remote_socket
+//	local_socket:host:hostport
+//	local_socket:remote_socket
+//
+// IPv6 addresses should be enclosed in square brackets,
+// an empty or '*' bind_address means listening on all interfaces,
+// and defaultBind is used if bind_address is not specified.
+func ParseForward(spec string, defaultBind string) (*Forward, error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 {
+		return nil, errors.Errorf("invalid forward spec %q", spec)
+	}
+
+	var (
+		fw   = &Forward{}
+		rest []string
+	)
+	last := fields[len(fields)-1]
+	if isSocketPath(last) {
+		fw.Dial = Endpoint{Network: "unix", Address: last}
+		rest = fields[:len(fields)-1]
+	} else {
+		if len(fields) < 3 {
+			return nil, errors.Errorf("invalid forward spec %q", spec)
+		}
+		host, port := fields[len(fields)-2], fields[len(fields)-1]
+		if host == "" {
+			return nil, errors.Errorf("missing host in forward spec %q", spec)
+		}
+		if err = validatePort(port, false); err != nil {
+			return nil, errors.Wrapf(err, "invalid forward spec %q", spec)
+		}
+		fw.Dial = Endpoint{Network: NETWORK, Address: net.JoinHostPort(host, port)}
+		rest = fields[:len(fields)-2]
+	}
+
+	switch len(rest) {
+	case 1:
+		if isSocketPath(rest[0]) {
+			fw.Listen = Endpoint{Network: "unix", Address: rest[0]}
+			return fw, nil
+		}
+		if err = validatePort(rest[0], true); err != nil {
+			return nil, errors.Wrapf(err, "invalid forward spec %q", spec)
+		}
+		fw.Listen = Endpoint{Network: NETWORK, Address: net.JoinHostPort(defaultBind, rest[0])}
+	case 2:
+		bind, port := rest[0], rest[1]
+		if bind == "*" {
+			bind = ""
+		}
+		if err = validatePort(port, true); err != nil {
+			return nil, errors.Wrapf(err, "invalid forward spec %q", spec)
+		}
+		fw.Listen = Endpoint{Network: NETWORK, Address: net.JoinHostPort(bind, port)}
+	default:
+		return nil, errors.Errorf("invalid forward spec %q", spec)
+	}
+	return fw, nil
+}
+
+// splitForwardSpec splits spec by colons, colons inside square brackets are kept
+func splitForwardSpec(spec string) ([]string, error) {
+	var (
+		fields  []string
+		cur     strings.Builder
+		bracket bool
+	)
+	for _, c := range spec {
+		switch {
+		case c == '[' && !bracket && cur.Len() == 0:
+			bracket = true
+		case c == ']' && bracket:
+			bracket = false
+		case c == ':' && !bracket:
+			fields = append(fields, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if bracket {
+		return nil, errors.Errorf("unclosed bracket in forward spec %q", spec)
+	}
+	return append(fields, cur.String()), nil
+}
+
+func isSocketPath(s string) bool {
+	return strings.Contains(s, "/")
+}
+
+func validatePort(s string, allowZero bool) error {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 || (port == 0 && !allowZero) {
+		return errors.Errorf("bad port %q", s)
+	}
+	return nil
+}
+
+// parseForwards parses all specs, see ParseForward for details
+func parseForwards(specs []string, defaultBind string) ([]*Forward, error) {
+	var forwards []*Forward
+	for _, spec := range specs {
+		fw, err := ParseForward(spec, defaultBind)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, fw)
+	}
+	return forwards, nil
+}
+
+// LocalForward listens on the local end of fw and relays every
+// accepted connection to the remote end through the ssh connection
+func (c *Client) LocalForward(ctx context.Context, fw *Forward) error {
+	if err := c.Login(ctx); err != nil {
+		return err
+	}
+	ln, err := net.Listen(fw.Listen.Network, fw.Listen.Address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", fw.Listen)
+	}
+	lg.Info("local forward %s", fw)
+	go serveForward(ctx, ln, fw.String(), relayTo(fw.String(), func() (net.Conn, error) {
+		return c.dialRemote(fw.Dial.Network, fw.Dial.Address)
+	}))
+	return nil
+}
+
+// RemoteForward asks the server to listen on the remote end of fw and
+// relays every connection accepted there to the local end, the listening
+// is requested again once reconnected
+func (c *Client) RemoteForward(ctx context.Context, fw *Forward) error {
+	if err := c.Login(ctx); err != nil {
+		return err
+	}
+	if err := c.listenRemote(ctx, fw); err != nil {
+		return err
+	}
+	c.remoteForwards = append(c.remoteForwards, fw)
+	return nil
+}
+
+// listenRemote serves fw on the current connection, the listener is closed along with it
+func (c *Client) listenRemote(ctx context.Context, fw *Forward) error {
+	ln, err := c.cli.Listen(fw.Listen.Network, fw.Listen.Address)
+	if err != nil {
+		option := "AllowTcpForwarding"
+		if fw.Listen.Network == "unix" {
+			option = "AllowStreamLocalForwarding"
+		}
+		return errors.Wrapf(err, "server refused to listen on %s, please check %s of sshd", fw.Listen, option)
+	}
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		// the port is allocated by server if 0 specified
+		host, _, _ := net.SplitHostPort(fw.Listen.Address)
+		fw.Listen.Address = net.JoinHostPort(host, strconv.Itoa(addr.Port))
+	}
+	lg.Info("remote forward %s", fw)
+	go serveForward(ctx, ln, fw.String(), relayTo(fw.String(), func() (net.Conn, error) {
+		return net.DialTimeout(fw.Dial.Network, fw.Dial.Address, entry.ConnectTimeout())
+	}))
+	return nil
+}
+
+// DynamicForward runs a SOCKS5 server on listen, the address requested
+// by each SOCKS client is connected through the ssh connection
+func (c *Client) DynamicForward(ctx context.Context, listen Endpoint) error {
+	if err := c.Login(ctx); err != nil {
+		return err
+	}
+	ln, err := net.Listen(listen.Network, listen.Address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", listen)
+	}
+	name := "socks5://" + listen.Address
+	lg.Info("dynamic forward %s", name)
+	go serveForward(ctx, ln, name, func(conn net.Conn) {
+		addr, err := socks5.Handshake(conn)
+		if err != nil {
+			lg.Debug("%s: %s", name, err)
+			_ = conn.Close()
+			return
+		}
+		target, err := c.dialRemote(NETWORK, addr)
+		if err != nil {
+			lg.Error("%s: failed to connect %s: %s", name, addr, err)
+			rep := socks5.GeneralFailure
+			var openErr *ssh.OpenChannelError
+			if errors.As(err, &openErr) && openErr.Reason == ssh.ConnectionFailed {
+				rep = socks5.ConnectionRefused
+			}
+			_ = socks5.Reply(conn, rep)
+			_ = conn.Close()
+			return
+		}
+		if err = socks5.Reply(conn, socks5.Succeeded); err != nil {
+			_ = conn.Close()
+			_ = target.Close()
+			return
+		}
+		lg.Debug("%s: connection from %s to %s", name, conn.RemoteAddr(), addr)
+		relay(conn, target)
+	})
+	return nil
+}
+
+// dialRemote connects addr from the server through the current connection,
+// which is replaced once reconnected
+func (c *Client) dialRemote(network, addr string) (net.Conn, error) {
+	c.mu.Lock()
+	cli := c.cli
+	c.mu.Unlock()
+	if cli == nil {
+		return nil, errors.Errorf("not connected to %s", c.entry.String())
+	}
+	return cli.Dial(network, addr)
+}
+
+// ParseDynamicForward parses [bind_address:]port spec of dynamic forwarding,
+// defaultBind is used if bind_address is not specified
+func ParseDynamicForward(spec string, defaultBind string) (Endpoint, error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	bind, port := defaultBind, fields[len(fields)-1]
+	switch len(fields) {
+	case 1:
+	case 2:
+		bind = fields[0]
+		if bind == "*" {
+			bind = ""
+		}
+	default:
+		return Endpoint{}, errors.Errorf("invalid dynamic forward spec %q", spec)
+	}
+	if err = validatePort(port, true); err != nil {
+		return Endpoint{}, errors.Wrapf(err, "invalid dynamic forward spec %q", spec)
+	}
+	return Endpoint{Network: NETWORK, Address: net.JoinHostPort(bind, port)}, nil
+}
+
+// serveForward accepts connections from ln until ctx is done
+// or ln is closed, and each of them is served by handle
+func serveForward(ctx context.Context, ln net.Listener, name string, handle func(conn net.Conn)) {
+	var closeOnce sync.Once
+	closeListener := func() {
+		closeOnce.Do(func() {
+			_ = ln.Close()
+		})
+	}
+	cleaner.RegisterCallback(closeListener)
+	go func() {
+		<-ctx.Done()
+		closeListener()
+	}()
+	defer closeListener()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			lg.Debug("forward %s stopped: %s", name, err)
+			return
+		}
+		go handle(conn)
+	}
+}
+
+// relayTo returns a handler relaying connections to the one returned by dial
+func relayTo(name string, dial func() (net.Conn, error)) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		target, err := dial()
+		if err != nil {
+			lg.Error("forward %s: %s", name, err)
+			_ = conn.Close()
+			return
+		}
+		lg.Debug("forward %s: connection from %s", name, conn.RemoteAddr())
+		relay(conn, target)
+	}
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// relay copies data between a and b in both directions,
+// write side is half closed once its peer reached EOF,
+// and both are closed after the two directions finished
+func relay(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyFn := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		if cw, ok := dst.(closeWriter); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyFn(a, b)
+	go copyFn(b, a)
+	wg.Wait()
+	_ = a.Close()
+	_ = b.Close()
+}
+
+// Wait keeps the connection alive without running any command,
+// until ctx is done or the connection is closed by server
+func (c *Client) Wait(ctx context.Context) error {
+	if err := c.Login(ctx); err != nil {
+		return err
+	}
+	defer c.close()
+
+	cli := c.cli
+	c.startKeepalive(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- cli.Wait()
+	}()
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-done:
+		if err == nil {
+			err = errors.Errorf("connection to %s closed", c.entry.String())
+		} else {
+			err = errors.Wrapf(err, "connection to %s closed", c.entry.String())
+		}
+		return &connectError{err: err}
+	}
+}
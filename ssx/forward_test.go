@@ -0,0 +1,306 @@
+package ssx
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected *Forward
+	}{
+		{
+			name:  "port only",
+			input: "8080:10.0.0.1:80",
+			expected: &Forward{
+				Listen: Endpoint{Network: "tcp", Address: "localhost:8080"},
+				Dial:   Endpoint{Network: "tcp", Address: "10.0.0.1:80"},
+			},
+		},
+		{
+			name:  "with bind address",
+			input: "0.0.0.0:8080:db:5432",
+			expected: &Forward{
+				Listen: Endpoint{Network: "tcp", Address: "0.0.0.0:8080"},
+				Dial:   Endpoint{Network: "tcp", Address: "db:5432"},
+			},
+		},
+		{
+			name:  "all interfaces",
+			input: "*:8080:db:5432",
+			expected: &Forward{
+				Listen: Endpoint{Network: "tcp", Address: ":8080"},
+				Dial:   Endpoint{Network: "tcp", Address: "db:5432"},
+			},
+		},
+		{
+			name:  "ipv6",
+			input: "[::1]:8080:[fe80::1]:80",
+			expected: &Forward{
+				Listen: Endpoint{Network: "tcp", Address: "[::1]:8080"},
+				Dial:   Endpoint{Network: "tcp", Address: "[fe80::1]:80"},
+			},
+		},
+		{
+			name:  "remote socket",
+			input: "2375:/var/run/docker.sock",
+			expected: &Forward{
+				Listen: Endpoint{Network: "tcp", Address: "localhost:2375"},
+				Dial:   Endpoint{Network: "unix", Address: "/var/run/docker.sock"},
+			},
+		},
+		{
+			name:  "local socket",
+			input: "/tmp/db.sock:db:5432",
+			expected: &Forward{
+				Listen: Endpoint{Network: "unix", Address: "/tmp/db.sock"},
+				Dial:   Endpoint{Network: "tcp", Address: "db:5432"},
+			},
+		},
+		{
+			name:  "socket to socket",
+			input: "./docker.sock:/var/run/docker.sock",
+			expected: &Forward{
+				Listen: Endpoint{Network: "unix", Address: "./docker.sock"},
+				Dial:   Endpoint{Network: "unix", Address: "/var/run/docker.sock"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, err := ParseForward(tt.input, "localhost")
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			assert.Equal(t, tt.expected, fw)
+		})
+	}
+
+	for _, invalid := range []string{"8080", "8080:db", "abc:db:80", "8080:db:0", "1:2:3:4:5", "[::1:8080:db:80", "8080::80"} {
+		_, err := ParseForward(invalid, "localhost")
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseDynamicForward(t *testing.T) {
+	ep, err := ParseDynamicForward("1080", "localhost")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, Endpoint{Network: "tcp", Address: "localhost:1080"}, ep)
+
+	ep, err = ParseDynamicForward("[::1]:1080", "localhost")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, Endpoint{Network: "tcp", Address: "[::1]:1080"}, ep)
+
+	ep, err = ParseDynamicForward("*:1080", "localhost")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, Endpoint{Network: "tcp", Address: ":1080"}, ep)
+
+	for _, invalid := range []string{"", "abc", "a:b:1080", "70000"} {
+		_, err = ParseDynamicForward(invalid, "localhost")
+		assert.Error(t, err, invalid)
+	}
+}
+
+func startEchoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// freeAddr returns a local address which is not listened
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	_ = ln.Close()
+	return ln.Addr().String()
+}
+
+// newForwardClient returns a client logged in s, whose forwards are stopped after the test
+func newForwardClient(t *testing.T, s *testServer) (*Client, context.Context) {
+	t.Setenv("HOME", t.TempDir())
+	c := NewClient(&entry.Entry{
+		Host:          s.host,
+		Port:          s.port,
+		User:          "test",
+		Password:      "secret",
+		DisableAgent:  true,
+		HostKeyPolicy: entry.HostKeyPolicyOff,
+	}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		c.close()
+	})
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	return c, ctx
+}
+
+// assertEcho sends a message through conn and expects it echoed back
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "ping", string(buf))
+}
+
+func dialEcho(t *testing.T, addr string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assertEcho(t, conn)
+}
+
+// dialSOCKS connects target through the SOCKS5 server on proxy
+func dialSOCKS(t *testing.T, proxy, target string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	host, portStr, _ := net.SplitHostPort(target)
+	port, _ := strconv.Atoi(portStr)
+	req := append([]byte{5, 1, 0, 5, 1, 0, 1}, net.ParseIP(host).To4()...)
+	req = append(req, byte(port>>8), byte(port))
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err = conn.Write(req); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	reply := make([]byte, 2+10)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, byte(0), reply[3], "SOCKS reply")
+	assertEcho(t, conn)
+}
+
+func TestLocalForward(t *testing.T) {
+	s := startTestServer(t)
+	c, ctx := newForwardClient(t, s)
+	echo := startEchoServer(t)
+	fw := &Forward{
+		Listen: Endpoint{Network: "tcp", Address: freeAddr(t)},
+		Dial:   Endpoint{Network: "tcp", Address: echo},
+	}
+	if err := c.LocalForward(ctx, fw); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	dialEcho(t, fw.Listen.Address)
+	assert.Equal(t, []string{echo}, s.dialedAddrs())
+}
+
+func TestRemoteForward(t *testing.T) {
+	s := startTestServer(t)
+	c, ctx := newForwardClient(t, s)
+	fw := &Forward{
+		Listen: Endpoint{Network: "tcp", Address: "127.0.0.1:0"},
+		Dial:   Endpoint{Network: "tcp", Address: startEchoServer(t)},
+	}
+	if err := c.RemoteForward(ctx, fw); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	// the port allocated by server is filled in
+	assert.NotEqual(t, "127.0.0.1:0", fw.Listen.Address)
+	dialEcho(t, fw.Listen.Address)
+}
+
+func TestDynamicForward(t *testing.T) {
+	s := startTestServer(t)
+	c, ctx := newForwardClient(t, s)
+	echo := startEchoServer(t)
+	listen := Endpoint{Network: "tcp", Address: freeAddr(t)}
+	if err := c.DynamicForward(ctx, listen); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	dialSOCKS(t, listen.Address, echo)
+	assert.Equal(t, []string{echo}, s.dialedAddrs())
+}
+
+func TestForwardReconnect(t *testing.T) {
+	s := startTestServer(t)
+	c, ctx := newForwardClient(t, s)
+	echo := startEchoServer(t)
+	local := &Forward{
+		Listen: Endpoint{Network: "tcp", Address: freeAddr(t)},
+		Dial:   Endpoint{Network: "tcp", Address: echo},
+	}
+	remote := &Forward{
+		Listen: Endpoint{Network: "tcp", Address: "127.0.0.1:0"},
+		Dial:   Endpoint{Network: "tcp", Address: echo},
+	}
+	socks := Endpoint{Network: "tcp", Address: freeAddr(t)}
+	if err := c.LocalForward(ctx, local); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if err := c.RemoteForward(ctx, remote); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if err := c.DynamicForward(ctx, socks); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	s.disconnect()
+	// wait until the remote listener is gone along with the connection
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("tcp", remote.Listen.Address)
+		if err != nil {
+			break
+		}
+		_ = conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("remote listener is not closed")
+		}
+	}
+	if err := c.reconnect(ctx); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	// all forwards work through the new connection
+	dialEcho(t, local.Listen.Address)
+	dialEcho(t, remote.Listen.Address)
+	dialSOCKS(t, socks.Address, echo)
+}
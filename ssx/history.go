@@ -0,0 +1,192 @@
+package ssx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/tui"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/env"
+	"github.com/vimiix/ssx/ssx/history"
+)
+
+// defaultHistoryLimit is the number of history records kept by default
+const defaultHistoryLimit = 10000
+
+// historyLimit returns the max number of history records kept, 0 means no limit
+func historyLimit() int {
+	val := os.Getenv(env.SSXHistoryLimit)
+	if val == "" {
+		return defaultHistoryLimit
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		lg.Debug("invalid %q value: %q", env.SSXHistoryLimit, val)
+		return defaultHistoryLimit
+	}
+	return n
+}
+
+// newHistory starts a connection record of e, it is saved by saveHistory
+func newHistory(e *entry.Entry, mode, command string) *history.Record {
+	return &history.Record{
+		Address: e.String(),
+		Mode:    mode,
+		Command: command,
+		Start:   time.Now(),
+	}
+}
+
+// saveHistory completes h with the result of connection and saves it,
+// failure of saving is not fatal
+func (s *SSX) saveHistory(h *history.Record, e *entry.Entry, err error) {
+	if os.Getenv(env.SSXNoHistory) != "" {
+		return
+	}
+	if e.Source == entry.SourceSSXStore {
+		// new entry gets its ID after login
+		h.EntryID = e.ID
+	}
+	h.End = time.Now()
+	h.ExitCode = ExitCode(err)
+	if err != nil && !IsRemoteExit(err) {
+		h.Error = err.Error()
+	}
+	if saveErr := s.repo.AddHistory(h, historyLimit()); saveErr != nil {
+		lg.Warn("failed to save history: %s", saveErr)
+	}
+}
+
+// HistoryOption holds options for history command
+type HistoryOption struct {
+	EntryID uint64
+	Tag     string
+	Since   time.Time
+	Limit   int // only the latest records are shown if positive
+	JSON    bool
+}
+
+// History prints the connection records matched by opt, the latest is the last
+func (s *SSX) History(opt *HistoryOption) error {
+	matched, err := s.matchHistory(opt)
+	if err != nil {
+		return err
+	}
+	if opt.JSON {
+		return printHistoryJSON(matched)
+	}
+	printHistoryTable(matched)
+	return nil
+}
+
+// matchHistory returns the connection records matched by opt in the order of start time
+func (s *SSX) matchHistory(opt *HistoryOption) ([]*history.Record, error) {
+	records, err := s.repo.GetAllHistory()
+	if err != nil {
+		return nil, err
+	}
+	var entryIDs map[uint64]bool
+	if opt.Tag != "" {
+		em, err := s.repo.GetAllEntries()
+		if err != nil {
+			return nil, err
+		}
+		entryIDs = map[uint64]bool{}
+		for _, e := range foundTargetByTag(em, opt.Tag) {
+			entryIDs[e.ID] = true
+		}
+	}
+
+	var matched []*history.Record
+	for _, h := range records {
+		if opt.EntryID > 0 && h.EntryID != opt.EntryID {
+			continue
+		}
+		if entryIDs != nil && !entryIDs[h.EntryID] {
+			continue
+		}
+		if h.Start.Before(opt.Since) {
+			continue
+		}
+		matched = append(matched, h)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Start.Before(matched[j].Start)
+	})
+	if opt.Limit > 0 && len(matched) > opt.Limit {
+		matched = matched[len(matched)-opt.Limit:]
+	}
+	return matched, nil
+}
+
+func printHistoryJSON(records []*history.Record) error {
+	type recordView struct {
+		*history.Record
+		Duration float64 `json:"duration"` // in seconds
+	}
+	views := make([]recordView, 0, len(records))
+	for _, h := range records {
+		views = append(views, recordView{Record: h, Duration: h.Duration().Seconds()})
+	}
+	bs, err := json.MarshalIndent(views, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func printHistoryTable(records []*history.Record) {
+	// the unique record id comes first, the first column is merged by PrintTable
+	header := []string{"#", "Start", "ID", "Address", "Mode", "Command", "Duration", "Exit Code", "Error"}
+	var rows [][]string
+	for _, h := range records {
+		id := ""
+		if h.EntryID > 0 {
+			id = strconv.FormatUint(h.EntryID, 10)
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(h.ID, 10),
+			h.Start.Format("2006-01-02 15:04:05"),
+			id, h.Address, h.Mode,
+			h.Command,
+			h.Duration().Round(time.Millisecond).String(),
+			strconv.Itoa(h.ExitCode),
+			h.Error,
+		})
+	}
+	tui.PrintTable(header, rows)
+}
+
+// ParseSince parses the start time of history, either a duration before now
+// like 24h, or a date time like 2006-01-02, 2006-01-02 15:04 or RFC3339 format
+func ParseSince(val string, now time.Time) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(val); err == nil {
+		return now.Add(-d), nil
+	}
+	if strings.HasSuffix(val, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(val, "d")); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, val, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("invalid time %q, expect duration like 24h, 7d or date like 2006-01-02", val)
+}
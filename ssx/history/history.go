@@ -0,0 +1,32 @@
+// Package history defines the records of connections made by ssx
+package history
+
+import (
+	"time"
+)
+
+// Modes of connection
+const (
+	ModeInteractive = "interactive"
+	ModeExec        = "exec"
+	ModeCopy        = "cp"
+	ModeForward     = "forward"
+)
+
+// Record is a connection to an entry
+type Record struct {
+	ID       uint64    `json:"id"`
+	EntryID  uint64    `json:"entry_id"` // 0 if the entry is not stored in ssx
+	Address  string    `json:"address"`
+	Mode     string    `json:"mode"`
+	Command  string    `json:"command,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exit_code"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Duration returns how long the connection lasted
+func (r *Record) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
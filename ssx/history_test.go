@@ -0,0 +1,110 @@
+package ssx
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vimiix/ssx/ssx/bbolt"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/env"
+	"github.com/vimiix/ssx/ssx/history"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		val     string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"24h", now.Add(-24 * time.Hour), false},
+		{"30m", now.Add(-30 * time.Minute), false},
+		{"7d", now.AddDate(0, 0, -7), false},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), false},
+		{"2024-01-02 15:04", time.Date(2024, 1, 2, 15, 4, 0, 0, time.Local), false},
+		{"2024-01-02T15:04:05Z", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			got, err := ParseSince(tt.val, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
+		})
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	t.Setenv(env.SSXHistoryLimit, "")
+	assert.Equal(t, defaultHistoryLimit, historyLimit())
+	t.Setenv(env.SSXHistoryLimit, "100")
+	assert.Equal(t, 100, historyLimit())
+	t.Setenv(env.SSXHistoryLimit, "0")
+	assert.Equal(t, 0, historyLimit())
+	t.Setenv(env.SSXHistoryLimit, "-1")
+	assert.Equal(t, defaultHistoryLimit, historyLimit())
+}
+
+func TestMatchHistory(t *testing.T) {
+	repo := bbolt.NewRepo(filepath.Join(t.TempDir(), "ssx.db"))
+	if err := repo.Init(); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	web := &entry.Entry{Host: "10.0.0.1", Port: "22", User: "root", Tags: []string{"web"}}
+	db := &entry.Entry{Host: "10.0.0.2", Port: "22", User: "root", Tags: []string{"db"}}
+	for _, e := range []*entry.Entry{web, db} {
+		if err := repo.TouchEntry(e); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+	}
+	now := time.Now()
+	// saved out of order of start time
+	for _, h := range []*history.Record{
+		{EntryID: web.ID, Start: now.Add(-time.Hour), Command: "web 1h ago"},
+		{EntryID: db.ID, Start: now.Add(-3 * time.Hour), Command: "db 3h ago"},
+		{EntryID: web.ID, Start: now.Add(-2 * time.Hour), Command: "web 2h ago"},
+		{EntryID: 0, Start: now.Add(-time.Minute), Command: "unsaved 1m ago"},
+	} {
+		if err := repo.AddHistory(h, 0); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+	}
+
+	s := &SSX{repo: repo}
+	tests := []struct {
+		name string
+		opt  *HistoryOption
+		want []string
+	}{
+		{"all", &HistoryOption{}, []string{"db 3h ago", "web 2h ago", "web 1h ago", "unsaved 1m ago"}},
+		{"id", &HistoryOption{EntryID: web.ID}, []string{"web 2h ago", "web 1h ago"}},
+		{"tag", &HistoryOption{Tag: "db"}, []string{"db 3h ago"}},
+		{"since", &HistoryOption{Since: now.Add(-90 * time.Minute)}, []string{"web 1h ago", "unsaved 1m ago"}},
+		{"limit", &HistoryOption{Limit: 2}, []string{"web 1h ago", "unsaved 1m ago"}},
+		{"combined", &HistoryOption{Tag: "web", Limit: 1}, []string{"web 1h ago"}},
+		{"no match", &HistoryOption{Tag: "cache"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := s.matchHistory(tt.opt)
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			var commands []string
+			for _, h := range records {
+				commands = append(commands, h.Command)
+			}
+			assert.Equal(t, tt.want, commands)
+		})
+	}
+}
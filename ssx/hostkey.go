@@ -0,0 +1,196 @@
+package ssx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/errmsg"
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/tui"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/hostkey"
+)
+
+// pinState describes how a known_hosts key relates to the pinned fingerprint
+func pinState(e *entry.Entry, fingerprint string) string {
+	switch e.HostKeyFingerprint {
+	case "":
+		return ""
+	case fingerprint:
+		return "yes"
+	default:
+		return "mismatch"
+	}
+}
+
+// ListHostKeys prints the known_hosts keys of stored entries,
+// all entries are listed if no id specified
+func (s *SSX) ListHostKeys(ids ...int) error {
+	em, err := s.repo.GetAllEntries()
+	if err != nil {
+		return err
+	}
+	var entries []*entry.Entry
+	if len(ids) == 0 {
+		for _, e := range em {
+			entries = append(entries, e)
+		}
+	} else {
+		for _, id := range ids {
+			e, ok := em[uint64(id)]
+			if !ok {
+				return errmsg.ErrEntryNotExist
+			}
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return errmsg.ErrNoEntry
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	header := []string{"ID", "Address", "Key Type", "Fingerprint", "Pinned", "Location"}
+	var rows [][]string
+	for _, e := range entries {
+		khPath := e.KnownHostsPath()
+		lines, lookupErr := hostkey.Lookup(khPath, e.Address())
+		if lookupErr != nil {
+			return errors.Wrapf(lookupErr, "failed to read %s", khPath)
+		}
+		id := strconv.Itoa(int(e.ID))
+		if len(lines) == 0 {
+			rows = append(rows, []string{id, e.String(), "-", "not found in " + khPath, pinState(e, ""), "-"})
+			continue
+		}
+		for _, l := range lines {
+			rows = append(rows, []string{
+				id, e.String(), l.Key.Type(), l.Fingerprint(), pinState(e, l.Fingerprint()),
+				fmt.Sprintf("%s:%d", l.File, l.Num),
+			})
+		}
+	}
+	tui.PrintTable(header, rows)
+	return nil
+}
+
+// ShowHostKeys prints the known_hosts keys and pinned fingerprint of entry
+func (s *SSX) ShowHostKeys(id int) error {
+	e, err := s.repo.GetEntry(uint64(id))
+	if err != nil {
+		return err
+	}
+	khPath := e.KnownHostsPath()
+	lines, err := hostkey.Lookup(khPath, e.Address())
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", khPath)
+	}
+	fmt.Printf("entry:       %d %s\n", e.ID, e.String())
+	fmt.Printf("known_hosts: %s\n", khPath)
+	if e.HostKeyFingerprint != "" {
+		fmt.Printf("pinned:      %s\n", e.HostKeyFingerprint)
+	}
+	if len(lines) == 0 {
+		fmt.Printf("no key of %s found\n", hostkey.Normalize(e.Address()))
+		return nil
+	}
+	fmt.Println()
+	header := []string{"Line", "Hosts", "Key Type", "Fingerprint", "Pinned"}
+	var rows [][]string
+	for _, l := range lines {
+		rows = append(rows, []string{
+			strconv.Itoa(l.Num), strings.Join(l.Hosts, ","), l.Key.Type(), l.Fingerprint(), pinState(e, l.Fingerprint()),
+		})
+	}
+	tui.PrintTable(header, rows)
+	return nil
+}
+
+// RemoveHostKeys deletes the known_hosts lines of entry
+func (s *SSX) RemoveHostKeys(id int) error {
+	e, err := s.repo.GetEntry(uint64(id))
+	if err != nil {
+		return err
+	}
+	khPath := e.KnownHostsPath()
+	n, err := hostkey.Remove(khPath, e.Address())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		lg.Info("no key of %s found in %s", hostkey.Normalize(e.Address()), khPath)
+		return nil
+	}
+	lg.Info("%d keys of %s removed from %s", n, hostkey.Normalize(e.Address()), khPath)
+	return nil
+}
+
+type AcceptHostKeyOption struct {
+	ID  int
+	Pin bool // also pin the fingerprint in entry
+	Yes bool // trust without confirmation
+}
+
+// AcceptHostKey fetches the current host key of entry and replaces
+// the known_hosts lines of it
+func (s *SSX) AcceptHostKey(ctx context.Context, opt *AcceptHostKeyOption) error {
+	e, err := s.repo.GetEntry(uint64(opt.ID))
+	if err != nil {
+		return err
+	}
+	lg.Info("fetching host key of %s", e.String())
+	key, remote, err := NewClient(e, s.repo).ScanHostKey(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch host key")
+	}
+	fp := ssh.FingerprintSHA256(key)
+	fmt.Printf("%s key fingerprint of %s is %s\n", key.Type(), hostkey.Normalize(e.Address()), fp)
+
+	if !opt.Yes {
+		prompt := promptui.Prompt{
+			Label:     "Trust this host key",
+			IsConfirm: true,
+		}
+		if _, err = prompt.Run(); err != nil {
+			return errors.New("host key not accepted")
+		}
+	}
+
+	addresses := []string{e.Address()}
+	if tcpAddr, ok := remote.(*net.TCPAddr); ok && tcpAddr.IP != nil && !tcpAddr.IP.IsUnspecified() &&
+		hostkey.Normalize(tcpAddr.String()) != hostkey.Normalize(e.Address()) {
+		addresses = append(addresses, tcpAddr.String())
+	}
+	khPath := e.KnownHostsPath()
+	n, err := hostkey.Remove(khPath, addresses...)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		lg.Info("%d old keys removed from %s", n, khPath)
+	}
+	if err = hostkey.Add(khPath, addresses, key); err != nil {
+		return err
+	}
+	lg.Info("host key of %s added to %s", hostkey.Normalize(e.Address()), khPath)
+
+	if opt.Pin {
+		e.HostKeyFingerprint = fp
+		if err = s.repo.SaveEntry(e); err != nil {
+			return err
+		}
+		lg.Info("fingerprint %s pinned for entry %d", fp, e.ID)
+	} else if e.HostKeyFingerprint != "" && e.HostKeyFingerprint != fp {
+		lg.Warn("entry %d pins another fingerprint %s, use --pin to update it", e.ID, e.HostKeyFingerprint)
+	}
+	return nil
+}
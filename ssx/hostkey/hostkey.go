@@ -0,0 +1,183 @@
+// Package hostkey manages the known_hosts lines which belong to entries
+package hostkey
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/vimiix/ssx/internal/lg"
+)
+
+// Line is a known_hosts line matching the looked up addresses
+type Line struct {
+	File  string
+	Num   int      // line number, starting from 1
+	Hosts []string // host patterns of the line, hashed ones are kept as-is
+	Key   ssh.PublicKey
+}
+
+func (l *Line) Fingerprint() string {
+	return ssh.FingerprintSHA256(l.Key)
+}
+
+// Normalize formats address the way known_hosts does, host for port 22,
+// [host]:port otherwise
+func Normalize(address string) string {
+	return knownhosts.Normalize(address)
+}
+
+// matchPattern reports whether a host pattern of known_hosts matches the
+// normalized address, wildcard and negated patterns are never matched.
+func matchPattern(pattern, normalized string) bool {
+	if strings.HasPrefix(pattern, "|") {
+		parts := strings.Split(pattern, "|")
+		if len(parts) != 4 || parts[1] != "1" {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[3])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(normalized))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return pattern == normalized
+}
+
+// parseLine returns the host patterns and key of a known_hosts line,
+// ok is false for comments, markers (@cert-authority, @revoked) and invalid lines
+func parseLine(line string) (hosts []string, key ssh.PublicKey, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "@") {
+		return nil, nil, false
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, nil, false
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[1:], " ")))
+	if err != nil {
+		return nil, nil, false
+	}
+	return strings.Split(fields[0], ","), key, true
+}
+
+func matchLine(hosts []string, addresses []string) bool {
+	for _, h := range hosts {
+		for _, addr := range addresses {
+			if matchPattern(h, Normalize(addr)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lookup returns the lines of file matching any of the addresses (host:port)
+func Lookup(file string, addresses ...string) ([]*Line, error) {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var lines []*Line
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	num := 0
+	for scanner.Scan() {
+		num++
+		hosts, key, ok := parseLine(scanner.Text())
+		if !ok || !matchLine(hosts, addresses) {
+			continue
+		}
+		lines = append(lines, &Line{File: file, Num: num, Hosts: hosts, Key: key})
+	}
+	return lines, scanner.Err()
+}
+
+// Remove deletes the whole lines of file matching any of the addresses,
+// the original file is kept as <file>.old like ssh-keygen -R does.
+func Remove(file string, addresses ...string) (int, error) {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var (
+		buf     bytes.Buffer
+		removed int
+		scanner = bufio.NewScanner(bytes.NewReader(bs))
+	)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if hosts, _, ok := parseLine(text); ok && matchLine(hosts, addresses) {
+			removed++
+			continue
+		}
+		buf.WriteString(text)
+		buf.WriteByte('\n')
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	if err = os.WriteFile(file+".old", bs, fi.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err = os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	lg.Debug("removed %d lines from %s, original file saved as %s.old", removed, file, file)
+	return removed, os.Rename(tmp.Name(), file)
+}
+
+// Add appends a line of key for addresses to file
+func Add(file string, addresses []string, key ssh.PublicKey) error {
+	var normalized []string
+	for _, addr := range addresses {
+		normalized = append(normalized, Normalize(addr))
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(knownhosts.Line(normalized, key) + "\n")
+	return err
+}
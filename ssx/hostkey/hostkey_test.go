@@ -0,0 +1,69 @@
+package hostkey
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	return key
+}
+
+func TestMatchPattern(t *testing.T) {
+	assert.True(t, matchPattern("192.168.1.100", "192.168.1.100"))
+	assert.True(t, matchPattern("[192.168.1.100]:2222", Normalize("192.168.1.100:2222")))
+	assert.False(t, matchPattern("192.168.1.100", Normalize("192.168.1.100:2222")))
+	assert.False(t, matchPattern("192.168.1.*", "192.168.1.100"))
+	assert.True(t, matchPattern(knownhosts.HashHostname("example.com"), "example.com"))
+	assert.False(t, matchPattern(knownhosts.HashHostname("example.com"), "example.org"))
+}
+
+func TestLookupAddRemove(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	key, otherKey := newTestKey(t), newTestKey(t)
+
+	assert.NoError(t, Add(file, []string{"example.com:22"}, key))
+	assert.NoError(t, Add(file, []string{"example.com:2222"}, otherKey))
+	f, _ := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+	_, _ = f.WriteString("# comment\n@cert-authority *.example.com " + string(ssh.MarshalAuthorizedKey(key)))
+	_ = f.Close()
+
+	lines, err := Lookup(file, "example.com:22")
+	assert.NoError(t, err)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, 1, lines[0].Num)
+		assert.Equal(t, ssh.FingerprintSHA256(key), lines[0].Fingerprint())
+	}
+
+	lines, err = Lookup(file, "example.com:2222")
+	assert.NoError(t, err)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, []string{"[example.com]:2222"}, lines[0].Hosts)
+	}
+
+	n, err := Remove(file, "example.com:2222")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.FileExists(t, file+".old")
+	lines, _ = Lookup(file, "example.com:2222")
+	assert.Empty(t, lines)
+	lines, _ = Lookup(file, "example.com:22")
+	assert.Len(t, lines, 1)
+	bs, _ := os.ReadFile(file)
+	assert.Contains(t, string(bs), "@cert-authority")
+}
@@ -0,0 +1,203 @@
+package ssx
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/terminal"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+const (
+	defaultKeepaliveInterval = 10 * time.Second
+	defaultKeepaliveCount    = 3
+	maxReconnectDelay        = 30 * time.Second
+	transportProbeTimeout    = 5 * time.Second
+)
+
+// keepaliveOption returns the interval and count of keepalive requests,
+// like ServerAliveInterval and ServerAliveCountMax of OpenSSH,
+// keepalive is disabled if interval is 0
+func keepaliveOption() (time.Duration, int) {
+	interval, count := defaultKeepaliveInterval, defaultKeepaliveCount
+	if val := os.Getenv(env.SSXKeepaliveInterval); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			lg.Debug("invalid %q value: %q", env.SSXKeepaliveInterval, val)
+		} else {
+			interval = d
+		}
+	}
+	if val := os.Getenv(env.SSXKeepaliveCount); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			lg.Debug("invalid %q value: %q", env.SSXKeepaliveCount, val)
+		} else {
+			count = n
+		}
+	}
+	return interval, count
+}
+
+// requestConn is the part of *ssh.Client used by keepalive
+type requestConn interface {
+	SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error)
+	Close() error
+}
+
+// startKeepalive sends keepalive requests on the current connection until ctx
+// is done or the connection is closed, see keepalive
+func (c *Client) startKeepalive(ctx context.Context) {
+	interval, count := keepaliveOption()
+	if interval == 0 {
+		return
+	}
+	go c.keepalive(ctx, c.cli, interval, count)
+}
+
+// keepalive sends a keepalive request on conn every interval. If no reply is
+// received for count requests in a row, the connection is considered lost and
+// closed, so that sessions on it stop hanging.
+func (c *Client) keepalive(ctx context.Context, conn requestConn, interval time.Duration, count int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+		// wait the reply before sending next request
+		for missed := 0; ; {
+			select {
+			case err := <-replied:
+				if err != nil {
+					// connection closed
+					return
+				}
+			case <-ticker.C:
+				missed++
+				lg.Debug("no reply of keepalive from %s, missed %d", c.entry.String(), missed)
+				if missed < count {
+					continue
+				}
+				lg.Error("no response from %s for %s, connection lost", c.entry.String(), interval*time.Duration(count))
+				c.lost.Store(true)
+				_ = conn.Close()
+				return
+			case <-ctx.Done():
+				return
+			}
+			break
+		}
+	}
+}
+
+// reconnect dials the entry through the same jump servers again,
+// until succeeded or ctx is done. Prompts are disabled, as stdin is still
+// read by sharedStdin for the next session, only the credentials entered
+// at login or stored are used.
+func (c *Client) reconnect(ctx context.Context) error {
+	c.close()
+	c.closeOnce = &sync.Once{}
+	c.lost.Store(false)
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		lg.Info("reconnecting to %s (attempt %d)", c.entry.String(), attempt)
+		// not Login, which asks for password again if failed
+		cli, err := c.dial(terminal.DisablePrompt(ctx))
+		if err == nil {
+			c.setClient(cli)
+			// remote listeners are gone along with the lost connection
+			for _, fw := range c.remoteForwards {
+				if err = c.listenRemote(ctx, fw); err != nil {
+					lg.Error("failed to restore remote forward %s: %s", fw, err)
+				}
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if errors.Is(err, terminal.ErrPromptDisabled) {
+			return errors.Wrap(err, "reconnecting requires input, login again manually")
+		}
+		lg.Warn("failed to reconnect: %s, retry in %s", err, delay)
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+var (
+	stdinOnce   sync.Once
+	stdinChunks chan []byte
+)
+
+// sharedStdin returns data read from stdin by a single goroutine, so that
+// a new session takes over stdin from the lost one without losing input
+func sharedStdin() <-chan []byte {
+	stdinOnce.Do(func() {
+		stdinChunks = make(chan []byte)
+		go func() {
+			defer close(stdinChunks)
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					stdinChunks <- append([]byte(nil), buf[:n]...)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return stdinChunks
+}
+
+// connectionLost reports whether the session ended with err because of lost
+// connection, that is closed by keepalive or the transport is closed. A session
+// closed by the server without exit status on a live connection is not lost.
+func (c *Client) connectionLost(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if c.lost.Load() {
+		return true
+	}
+	c.mu.Lock()
+	cli := c.cli
+	c.mu.Unlock()
+	return cli == nil || !transportAlive(cli, transportProbeTimeout)
+}
+
+// transportAlive sends a keepalive request on conn, which fails at once if
+// the transport is closed, no reply within timeout is considered dead as well
+func transportAlive(conn requestConn, timeout time.Duration) bool {
+	replied := make(chan error, 1)
+	go func() {
+		_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
+		replied <- err
+	}()
+	select {
+	case err := <-replied:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,149 @@
+package ssx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+func TestKeepaliveOption(t *testing.T) {
+	t.Setenv(env.SSXKeepaliveInterval, "")
+	t.Setenv(env.SSXKeepaliveCount, "")
+	interval, count := keepaliveOption()
+	assert.Equal(t, defaultKeepaliveInterval, interval)
+	assert.Equal(t, defaultKeepaliveCount, count)
+
+	t.Setenv(env.SSXKeepaliveInterval, "30s")
+	t.Setenv(env.SSXKeepaliveCount, "5")
+	interval, count = keepaliveOption()
+	assert.Equal(t, 30*time.Second, interval)
+	assert.Equal(t, 5, count)
+
+	t.Setenv(env.SSXKeepaliveInterval, "0")
+	interval, _ = keepaliveOption()
+	assert.Equal(t, time.Duration(0), interval)
+
+	t.Setenv(env.SSXKeepaliveInterval, "-1s")
+	t.Setenv(env.SSXKeepaliveCount, "0")
+	interval, count = keepaliveOption()
+	assert.Equal(t, defaultKeepaliveInterval, interval)
+	assert.Equal(t, defaultKeepaliveCount, count)
+
+	t.Setenv(env.SSXKeepaliveInterval, "abc")
+	t.Setenv(env.SSXKeepaliveCount, "abc")
+	interval, count = keepaliveOption()
+	assert.Equal(t, defaultKeepaliveInterval, interval)
+	assert.Equal(t, defaultKeepaliveCount, count)
+}
+
+// silentConn never replies keepalive requests until closed
+type silentConn struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+	requests  int
+	mu        sync.Mutex
+}
+
+func newSilentConn() *silentConn {
+	return &silentConn{closed: make(chan struct{})}
+}
+
+func (c *silentConn) SendRequest(string, bool, []byte) (bool, []byte, error) {
+	c.mu.Lock()
+	c.requests++
+	c.mu.Unlock()
+	<-c.closed
+	return false, nil, errors.New("closed")
+}
+
+func (c *silentConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func TestKeepaliveConnectionLost(t *testing.T) {
+	c := NewClient(&entry.Entry{Host: "10.0.0.1", Port: "22", User: "root"}, nil)
+	conn := newSilentConn()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.keepalive(context.Background(), conn, 10*time.Millisecond, 3)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("keepalive did not detect the lost connection")
+	}
+	assert.True(t, c.lost.Load())
+	select {
+	case <-conn.closed:
+	default:
+		t.Fatal("connection is not closed")
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	// next request is not sent before the reply
+	assert.Equal(t, 1, conn.requests)
+}
+
+func TestKeepaliveCanceled(t *testing.T) {
+	c := NewClient(&entry.Entry{Host: "10.0.0.1", Port: "22", User: "root"}, nil)
+	conn := newSilentConn()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.keepalive(ctx, conn, 10*time.Millisecond, 3)
+	assert.False(t, c.lost.Load())
+}
+
+func TestConnectionLost(t *testing.T) {
+	s := startTestServer(t)
+	s.exec = func(_, command string, _ io.Writer) int {
+		if command == "exit" {
+			return 0
+		}
+		// closed without exit status
+		return -1
+	}
+	c, ctx := newForwardClient(t, s)
+	run := func(command string) error {
+		sess, err := c.cli.NewSession()
+		if err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		defer sess.Close()
+		return sess.Run(command)
+	}
+
+	assert.False(t, c.connectionLost(ctx, run("exit")))
+	err := run("kill")
+	var missingErr *ssh.ExitMissingError
+	assert.ErrorAs(t, err, &missingErr)
+	assert.False(t, c.connectionLost(ctx, err))
+	// closed by keepalive
+	c.lost.Store(true)
+	assert.True(t, c.connectionLost(ctx, err))
+	c.lost.Store(false)
+
+	s.disconnect()
+	_ = c.cli.Wait()
+	assert.True(t, c.connectionLost(ctx, err))
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, c.connectionLost(canceled, err))
+}
+
+func TestTransportAlive(t *testing.T) {
+	conn := newSilentConn()
+	assert.False(t, transportAlive(conn, 10*time.Millisecond))
+	_ = conn.Close()
+	assert.False(t, transportAlive(conn, time.Second))
+}
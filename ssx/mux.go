@@ -0,0 +1,164 @@
+package ssx
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/tui"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/mux"
+)
+
+// newClient creates client of e, the connection of stored entry
+// is shared through mux master if multiplexing enabled
+func (s *SSX) newClient(e *entry.Entry) *Client {
+	client := NewClient(e, s.repo)
+	if e.ID == 0 || e.Source != entry.SourceSSXStore || !mux.Enabled() {
+		return client
+	}
+	client.dialMux = func(ctx context.Context) (*ssh.Client, error) {
+		path, err := mux.SocketPath(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		if cli, err := mux.Dial(path); err == nil {
+			return cli, nil
+		}
+		lg.Debug("no mux master of entry %d running, start one", e.ID)
+		return mux.Spawn(ctx, e.ID, s.opt.DBFile)
+	}
+	return client
+}
+
+// ServeMux runs the mux master of stored entry id, it is started by
+// `ssx mux serve` in background and detaches from terminal after login
+func (s *SSX) ServeMux(ctx context.Context, id int) error {
+	e, err := s.repo.GetEntry(uint64(id))
+	if err != nil {
+		return err
+	}
+	client := NewClient(e, s.repo)
+	cli, err := client.connect(ctx)
+	if err != nil {
+		return err
+	}
+	client.cli = cli
+	defer client.close()
+	client.startKeepalive(ctx)
+
+	logPath, err := mux.LogPath(e.ID)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	return mux.Serve(ctx, &mux.MasterOption{
+		EntryID:     e.ID,
+		Address:     e.String(),
+		Upstream:    cli,
+		IdleTimeout: mux.IdleTimeout(),
+		OnReady: func() {
+			lg.SetOutput(logFile)
+			if err := mux.Detach(logFile); err != nil {
+				lg.Error("failed to detach from terminal: %s", err)
+			}
+		},
+	})
+}
+
+// muxMasters connects masters of given entry ids, or all running
+// masters if no id specified, stale sockets are removed
+func muxMasters(ids ...int) (map[uint64]*ssh.Client, error) {
+	sockets, err := mux.Sockets()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		wanted := map[uint64]string{}
+		for _, id := range ids {
+			if path, ok := sockets[uint64(id)]; ok {
+				wanted[uint64(id)] = path
+			} else {
+				lg.Warn("no mux master of entry %d running", id)
+			}
+		}
+		sockets = wanted
+	}
+	clients := map[uint64]*ssh.Client{}
+	for id, path := range sockets {
+		cli, err := mux.Dial(path)
+		if err != nil {
+			lg.Debug("removing stale socket %s: %s", path, err)
+			_ = os.Remove(path)
+			continue
+		}
+		clients[id] = cli
+	}
+	return clients, nil
+}
+
+// MuxStatus prints running mux masters
+func (s *SSX) MuxStatus(ids ...int) error {
+	clients, err := muxMasters(ids...)
+	if err != nil {
+		return err
+	}
+	if len(clients) == 0 {
+		lg.Info("no mux master running")
+		return nil
+	}
+	var statuses []*mux.Status
+	for id, cli := range clients {
+		status, err := mux.QueryStatus(cli)
+		_ = cli.Close()
+		if err != nil {
+			lg.Error("failed to query mux master of entry %d: %s", id, err)
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].EntryID < statuses[j].EntryID
+	})
+	header := []string{"ID", "Address", "PID", "Clients", "Uptime", "Idle Timeout"}
+	var rows [][]string
+	for _, st := range statuses {
+		rows = append(rows, []string{
+			strconv.FormatUint(st.EntryID, 10),
+			st.Address,
+			strconv.Itoa(st.PID),
+			strconv.Itoa(st.Clients),
+			st.Uptime().String(),
+			st.IdleTimeout.String(),
+		})
+	}
+	tui.PrintTable(header, rows)
+	return nil
+}
+
+// StopMux stops mux masters of given entry ids, or all if no id specified
+func (s *SSX) StopMux(ids ...int) error {
+	clients, err := muxMasters(ids...)
+	if err != nil {
+		return err
+	}
+	for id, cli := range clients {
+		err := mux.Stop(cli)
+		_ = cli.Close()
+		if err != nil {
+			lg.Error("failed to stop mux master of entry %d: %s", id, err)
+			continue
+		}
+		lg.Info("mux master of entry %d stopped", id)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package mux
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Detach moves the master out of the terminal session it was started in,
+// standard streams are redirected to /dev/null and stderr goes to logFile.
+func Detach(logFile *os.File) error {
+	if _, err := unix.Setsid(); err != nil {
+		return err
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+	for _, fd := range []int{0, 1, 2} {
+		if err = unix.Dup2(int(null.Fd()), fd); err != nil {
+			return err
+		}
+	}
+	if logFile != nil {
+		return unix.Dup2(int(logFile.Fd()), 2)
+	}
+	return nil
+}
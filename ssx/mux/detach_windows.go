@@ -0,0 +1,27 @@
+//go:build windows
+
+package mux
+
+import (
+	"os"
+	"syscall"
+)
+
+var procFreeConsole = syscall.NewLazyDLL("kernel32.dll").NewProc("FreeConsole")
+
+// Detach releases the console the master was started in,
+// standard streams are redirected to NUL and stderr goes to logFile.
+func Detach(logFile *os.File) error {
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	os.Stdin, os.Stdout, os.Stderr = null, null, null
+	if logFile != nil {
+		os.Stderr = logFile
+	}
+	if r, _, err := procFreeConsole.Call(); r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package mux
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/utils"
+)
+
+// MasterOption configures a master
+type MasterOption struct {
+	EntryID     uint64
+	Address     string // address of upstream, for display only
+	Upstream    *ssh.Client
+	IdleTimeout time.Duration
+	OnReady     func() // called once the socket is ready for clients
+}
+
+type master struct {
+	opt     *MasterOption
+	config  *ssh.ServerConfig
+	started time.Time
+
+	mu         sync.Mutex
+	conns      map[*ssh.ServerConn]struct{}
+	lastActive time.Time
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// Serve runs master of the upstream connection until ctx is done,
+// the upstream connection is closed, it is idle for too long
+// or stopped by client.
+func Serve(ctx context.Context, opt *MasterOption) error {
+	path, err := SocketPath(opt.EntryID)
+	if err != nil {
+		return err
+	}
+	config, err := serverConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := listen(path)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	m := &master{
+		opt:        opt,
+		config:     config,
+		started:    time.Now(),
+		conns:      map[*ssh.ServerConn]struct{}{},
+		lastActive: time.Now(),
+		stopped:    make(chan struct{}),
+	}
+	lg.Info("mux master of %s listening on %s", opt.Address, path)
+	if opt.OnReady != nil {
+		opt.OnReady()
+	}
+
+	go m.acceptLoop(ln)
+	go func() {
+		err := opt.Upstream.Wait()
+		lg.Info("upstream connection closed: %v", err)
+		m.stop()
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			lg.Info("mux master canceled")
+			m.shutdown()
+			return nil
+		case <-m.stopped:
+			m.shutdown()
+			return nil
+		case <-ticker.C:
+			if m.idleFor() >= opt.IdleTimeout {
+				lg.Info("mux master idle for %s, exit", opt.IdleTimeout)
+				m.shutdown()
+				return nil
+			}
+		}
+	}
+}
+
+func serverConfig() (*ssh.ServerConfig, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	// the socket is only accessible by current user
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	return config, nil
+}
+
+// listen creates the socket of master, a stale socket left
+// by a crashed master is removed
+func listen(path string) (net.Listener, error) {
+	if utils.FileExists(path) {
+		if cli, err := Dial(path); err == nil {
+			_ = cli.Close()
+			return nil, errors.Errorf("mux master is already running on %s", path)
+		}
+		lg.Debug("removing stale socket %s", path)
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func (m *master) stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopped)
+	})
+}
+
+func (m *master) shutdown() {
+	m.mu.Lock()
+	for conn := range m.conns {
+		_ = conn.Close()
+	}
+	m.mu.Unlock()
+	_ = m.opt.Upstream.Close()
+}
+
+func (m *master) idleFor() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.conns) > 0 {
+		return 0
+	}
+	return time.Since(m.lastActive)
+}
+
+func (m *master) status() *Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &Status{
+		PID:         os.Getpid(),
+		EntryID:     m.opt.EntryID,
+		Address:     m.opt.Address,
+		Started:     m.started,
+		Clients:     len(m.conns),
+		IdleTimeout: m.opt.IdleTimeout,
+	}
+}
+
+func (m *master) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			lg.Debug("mux master stop accepting: %s", err)
+			m.stop()
+			return
+		}
+		go m.serveConn(conn)
+	}
+}
+
+func (m *master) serveConn(conn net.Conn) {
+	sc, chans, reqs, err := ssh.NewServerConn(conn, m.config)
+	if err != nil {
+		lg.Debug("mux handshake failed: %s", err)
+		_ = conn.Close()
+		return
+	}
+	m.mu.Lock()
+	m.conns[sc] = struct{}{}
+	m.mu.Unlock()
+	lg.Debug("mux client connected")
+	defer func() {
+		m.mu.Lock()
+		delete(m.conns, sc)
+		m.lastActive = time.Now()
+		m.mu.Unlock()
+		lg.Debug("mux client disconnected")
+	}()
+
+	go m.handleRequests(reqs)
+	for nc := range chans {
+		go m.handleChannel(nc)
+	}
+	_ = sc.Wait()
+}
+
+// handleRequests answers global requests of client
+func (m *master) handleRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case requestStatus:
+			status := m.status()
+			// the requesting client itself is not counted
+			status.Clients--
+			payload, err := json.Marshal(status)
+			_ = req.Reply(err == nil, payload)
+		case requestStop:
+			lg.Info("mux master stopped by client")
+			_ = req.Reply(true, nil)
+			m.stop()
+		case "keepalive@openssh.com":
+			// check the upstream connection as well
+			_, _, err := m.opt.Upstream.SendRequest(req.Type, true, nil)
+			_ = req.Reply(err == nil, nil)
+		default:
+			lg.Debug("mux master rejects global request %q", req.Type)
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// handleChannel opens the same channel on upstream and proxies between them
+func (m *master) handleChannel(nc ssh.NewChannel) {
+	up, upReqs, err := m.opt.Upstream.OpenChannel(nc.ChannelType(), nc.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			_ = nc.Reject(openErr.Reason, openErr.Message)
+		} else {
+			_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	down, downReqs, err := nc.Accept()
+	if err != nil {
+		_ = up.Close()
+		go ssh.DiscardRequests(upReqs)
+		return
+	}
+	proxyChannel(down, downReqs, up, upReqs)
+}
+
+// proxyChannel relays data and requests between the client side channel down
+// and upstream channel up, down is closed after upstream finished.
+func proxyChannel(down ssh.Channel, downReqs <-chan *ssh.Request, up ssh.Channel, upReqs <-chan *ssh.Request) {
+	go func() {
+		_, _ = io.Copy(up, down)
+		_ = up.CloseWrite()
+	}()
+	go func() {
+		forwardRequests(up, downReqs)
+		// client closed the channel
+		_ = up.Close()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(down, up)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(down.Stderr(), up.Stderr())
+	}()
+	// requests like exit-status are sent before upstream closed
+	forwardRequests(down, upReqs)
+	wg.Wait()
+	_ = down.CloseWrite()
+	_ = down.Close()
+}
+
+func forwardRequests(dst ssh.Channel, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		ok, err := dst.SendRequest(req.Type, req.WantReply, req.Payload)
+		if req.WantReply {
+			_ = req.Reply(ok && err == nil, nil)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package mux shares an authenticated ssh connection between ssx processes.
+//
+// A master process keeps the connection of one entry and serves an in-process
+// ssh server on a unix socket only accessible by current user, later ssx
+// processes connect to the socket as a normal ssh server, every channel
+// and request opened there is proxied to the upstream connection.
+package mux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/utils"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+const (
+	requestStatus = "status@ssx"
+	requestStop   = "stop@ssx"
+
+	defaultIdleTimeout = 10 * time.Minute
+)
+
+// Enabled reports whether connection multiplexing is turned on by SSX_MUX
+func Enabled() bool {
+	return os.Getenv(env.SSXMux) != ""
+}
+
+// IdleTimeout returns how long the master keeps running without any client
+func IdleTimeout() time.Duration {
+	val := os.Getenv(env.SSXMuxIdleTimeout)
+	if val == "" {
+		return defaultIdleTimeout
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		lg.Debug("invalid %q value: %q", env.SSXMuxIdleTimeout, val)
+		return defaultIdleTimeout
+	}
+	return d
+}
+
+// SocketDir returns the directory holding sockets and logs of masters,
+// it is created with permission 0700 if not exist
+func SocketDir() (string, error) {
+	username, err := utils.CurrentUserName()
+	if err != nil {
+		return "", err
+	}
+	// domain user on windows looks like DOMAIN\user
+	dir := filepath.Join(os.TempDir(), "ssx-"+strings.ReplaceAll(username, `\`, "_"))
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	// make sure it is private even if created by others before
+	if err = os.Chmod(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// SocketPath returns the socket path of the master of entry id
+func SocketPath(id uint64) (string, error) {
+	dir, err := SocketDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("mux-%d.sock", id)), nil
+}
+
+// LogPath returns the log file of the master of entry id
+func LogPath(id uint64) (string, error) {
+	dir, err := SocketDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("mux-%d.log", id)), nil
+}
+
+// Sockets returns entry id and socket path of all masters
+func Sockets() (map[uint64]string, error) {
+	dir, err := SocketDir()
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "mux-*.sock"))
+	if err != nil {
+		return nil, err
+	}
+	sockets := map[uint64]string{}
+	for _, path := range matches {
+		var id uint64
+		if _, err = fmt.Sscanf(filepath.Base(path), "mux-%d.sock", &id); err != nil {
+			continue
+		}
+		sockets[id] = path
+	}
+	return sockets, nil
+}
+
+// Dial connects the master listening on socket path,
+// the returned client can be used as the upstream one
+func Dial(path string) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User: "ssx",
+		// the socket is placed in a directory only accessible by current user,
+		// and the host key of master is generated on every start
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         time.Second * 5,
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, path, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// Status is the running state of a master
+type Status struct {
+	PID         int           `json:"pid"`
+	EntryID     uint64        `json:"entry_id"`
+	Address     string        `json:"address"`
+	Started     time.Time     `json:"started"`
+	Clients     int           `json:"clients"`
+	IdleTimeout time.Duration `json:"idle_timeout"`
+}
+
+// Uptime returns how long the master has been running
+func (s *Status) Uptime() time.Duration {
+	return time.Since(s.Started).Truncate(time.Second)
+}
+
+func (s *Status) String() string {
+	return fmt.Sprintf("master of %s (pid %d)", s.Address, s.PID)
+}
+
+// QueryStatus asks the state of master connected by cli
+func QueryStatus(cli *ssh.Client) (*Status, error) {
+	ok, payload, err := cli.SendRequest(requestStatus, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("status request denied by mux master")
+	}
+	status := &Status{}
+	if err = json.Unmarshal(payload, status); err != nil {
+		return nil, errors.Wrap(err, "invalid status of mux master")
+	}
+	return status, nil
+}
+
+// Stop asks the master connected by cli to exit, the upstream
+// connection and all sessions through it are closed
+func Stop(cli *ssh.Client) error {
+	ok, _, err := cli.SendRequest(requestStop, true, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("stop request denied by mux master")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package mux
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// startUpstream runs a ssh server answering every exec request
+// with the command itself as output and exit status 3
+func startUpstream(t *testing.T) *ssh.Client {
+	config, err := serverConfig()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for nc := range chans {
+			ch, chReqs, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+			go func() {
+				for req := range chReqs {
+					if req.Type != "exec" {
+						_ = req.Reply(false, nil)
+						continue
+					}
+					_ = req.Reply(true, nil)
+					_, _ = ch.Write(req.Payload[4:])
+					_, _ = ch.Stderr().Write([]byte("err"))
+					_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{3}))
+					_ = ch.Close()
+				}
+			}()
+		}
+	}()
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+	cli, err := ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	return cli
+}
+
+func TestServe(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	upstream := startUpstream(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, &MasterOption{
+			EntryID:     1,
+			Address:     "test@127.0.0.1",
+			Upstream:    upstream,
+			IdleTimeout: time.Minute,
+			OnReady:     func() { close(ready) },
+		})
+	}()
+	<-ready
+
+	path, err := SocketPath(1)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	cli, err := Dial(path)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	defer cli.Close()
+
+	sess, err := cli.NewSession()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	out, err := sess.CombinedOutput("hello")
+	assert.Contains(t, string(out), "hello")
+	assert.Contains(t, string(out), "err")
+	exitErr, ok := err.(*ssh.ExitError)
+	if assert.True(t, ok, "expect exit error, got %v", err) {
+		assert.Equal(t, 3, exitErr.ExitStatus())
+	}
+
+	status, err := QueryStatus(cli)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, uint64(1), status.EntryID)
+	assert.Equal(t, 0, status.Clients)
+
+	sockets, err := Sockets()
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, map[uint64]string{1: path}, sockets)
+
+	assert.NoError(t, Stop(cli))
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("master not stopped")
+	}
+}
@@ -0,0 +1,66 @@
+package mux
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+// Spawn starts master of entry id in background with `ssx mux serve`
+// and returns a client connected to it once ready. The master shares the
+// terminal until authenticated, so prompts of it are shown as usual.
+func Spawn(ctx context.Context, id uint64, dbFile string) (*ssh.Client, error) {
+	path, err := SocketPath(id)
+	if err != nil {
+		return nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"mux", "serve", "--id", strconv.FormatUint(id, 10)}
+	if lg.IsVerbose() {
+		args = append(args, "--verbose")
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), env.SSXDBPath+"="+dbFile)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	lg.Debug("starting mux master: %s", cmd.String())
+	if err = cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "failed to start mux master")
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	ticker := time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = cmd.Process.Kill()
+			return nil, ctx.Err()
+		case err = <-exited:
+			// another master may win the race
+			if cli, dialErr := Dial(path); dialErr == nil {
+				return cli, nil
+			}
+			return nil, errors.Errorf("mux master exited: %v", err)
+		case <-ticker.C:
+			if cli, dialErr := Dial(path); dialErr == nil {
+				return cli, nil
+			}
+		}
+	}
+}
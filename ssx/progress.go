@@ -0,0 +1,223 @@
+package ssx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/terminal"
+)
+
+const (
+	progressInterval    = 200 * time.Millisecond // refresh interval of progress bar
+	progressLogInterval = 5 * time.Second        // interval of progress log lines if stderr is not a terminal
+	progressBarWidth    = 20
+	progressWarmUp      = time.Second // overall ETA is not estimated before it
+)
+
+// progress reports the transfer progress of the current file, and the overall
+// progress of recursive copies once the total is known. It is drawn as a bar
+// if out is a terminal, otherwise logged periodically.
+// A nil *progress reports nothing.
+type progress struct {
+	out   io.Writer
+	tty   bool
+	width int
+	now   func() time.Time
+
+	start                  time.Time
+	totalFiles, totalBytes int64 // overall is not reported if totalFiles is zero
+	doneFiles, doneBytes   int64 // doneBytes counts bytes transferred only
+	skippedBytes           int64 // bytes of files resumed from
+
+	name      string
+	size      int64
+	offset    int64 // the file is resumed from
+	cur       int64 // bytes transferred from offset
+	fileStart time.Time
+	last      time.Time
+	drawn     bool
+}
+
+// newProgress returns the progress on stderr, or nil if quiet
+func newProgress(quiet bool) *progress {
+	if quiet {
+		return nil
+	}
+	return &progress{
+		out:   os.Stderr,
+		tty:   terminal.IsTerminal(os.Stderr),
+		width: terminal.Width(os.Stderr),
+		now:   time.Now,
+		start: time.Now(),
+	}
+}
+
+// setTotal enables the overall progress, which starts from now
+func (p *progress) setTotal(files, bytes int64) {
+	if p == nil {
+		return
+	}
+	p.totalFiles, p.totalBytes = files, bytes
+	p.start = p.now()
+}
+
+func (p *progress) startFile(name string, size, offset int64) {
+	if p == nil {
+		return
+	}
+	p.name, p.size, p.offset, p.cur = name, size, offset, 0
+	p.fileStart = p.now()
+	p.last = p.fileStart
+	p.drawn = false
+}
+
+// writer counts bytes written to w as the progress of the current file
+func (p *progress) writer(w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return &progressWriter{w: w, p: p}
+}
+
+func (p *progress) add(n int64) {
+	p.cur += n
+	now := p.now()
+	if p.tty && now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.draw()
+	} else if !p.tty && now.Sub(p.last) >= progressLogInterval {
+		p.last = now
+		lg.Info("%s: %s", p.name, p.status())
+	}
+}
+
+// finishFile ends the line of the current file, which is counted as done if err is nil
+func (p *progress) finishFile(err error) {
+	if p == nil {
+		return
+	}
+	if err == nil {
+		p.doneFiles++
+		p.doneBytes += p.cur
+		p.skippedBytes += p.offset
+	}
+	if !p.tty {
+		return
+	}
+	if err == nil || p.drawn {
+		p.draw()
+		_, _ = fmt.Fprintln(p.out)
+	}
+}
+
+// summary returns the total bytes transferred and the average rate
+func (p *progress) summary() string {
+	if p == nil {
+		return ""
+	}
+	elapsed := p.now().Sub(p.start)
+	return fmt.Sprintf("%s transferred in %s, %s/s", formatBytes(p.doneBytes),
+		elapsed.Round(time.Millisecond), formatBytes(rate(p.doneBytes, elapsed)))
+}
+
+func (p *progress) draw() {
+	status := p.status()
+	nameWidth := p.width - 1 - runewidth.StringWidth(status) - 1
+	if nameWidth >= progressBarWidth+2+10 {
+		status = progressBar(p.offset+p.cur, p.size, progressBarWidth) + " " + status
+		nameWidth -= progressBarWidth + 3
+	}
+	nameWidth = max(nameWidth, 0)
+	name := runewidth.FillRight(runewidth.Truncate(p.name, nameWidth, "…"), nameWidth)
+	line := runewidth.Truncate(name+" "+status, p.width-1, "")
+	_, _ = fmt.Fprint(p.out, "\r"+runewidth.FillRight(line, p.width-1))
+	p.drawn = true
+}
+
+// status returns bytes, percent, rate and ETA of the current file, followed by the overall ones
+func (p *progress) status() string {
+	now := p.now()
+	fileRate := rate(p.cur, now.Sub(p.fileStart))
+	cur := p.offset + p.cur
+	// fields are padded so that the line does not jump around
+	s := fmt.Sprintf("%9s/%-9s %3d%% %9s/s ETA %-8s", formatBytes(cur), formatBytes(p.size),
+		percent(cur, p.size), formatBytes(fileRate), eta(p.size-cur, fileRate))
+	if p.totalFiles == 0 {
+		return s
+	}
+	var totalRate int64
+	if elapsed := now.Sub(p.start); elapsed >= progressWarmUp {
+		totalRate = rate(p.doneBytes+p.cur, elapsed)
+	}
+	done := p.skippedBytes + p.doneBytes + cur
+	digits := len(strconv.FormatInt(p.totalFiles, 10))
+	return s + fmt.Sprintf(" | total %*d/%d files %3d%% ETA %s", digits, p.doneFiles, p.totalFiles,
+		percent(done, p.totalBytes), eta(p.totalBytes-done, totalRate))
+}
+
+// progressWriter reports bytes written to p
+type progressWriter struct {
+	w io.Writer
+	p *progress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.p.add(int64(n))
+	return n, err
+}
+
+func progressBar(cur, total int64, width int) string {
+	filled := width
+	if total > 0 {
+		filled = int(min(cur, total) * int64(width) / total)
+	}
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+}
+
+func percent(cur, total int64) int64 {
+	if total <= 0 {
+		return 100
+	}
+	return min(cur, total) * 100 / total
+}
+
+// rate returns bytes per second
+func rate(n int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed.Seconds())
+}
+
+// eta returns the remaining time of n bytes in rate, or "--" if unknown
+func eta(n, rate int64) string {
+	if n <= 0 {
+		return "0s"
+	}
+	if rate <= 0 {
+		return "--"
+	}
+	return (time.Duration(n/rate) * time.Second).String()
+}
+
+// formatBytes formats n in binary units, e.g. 1.5MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,271 @@
+package ssx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/asciicast"
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/tui"
+	"github.com/vimiix/ssx/internal/utils"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+const (
+	defaultRecordDir = "~/.ssx/recordings"
+	recordTimeFormat = "20060102-150405"
+	recordExt        = ".cast"
+	maxRecordSuffix  = 100
+)
+
+// RecordDir returns the directory of session recordings
+func RecordDir() string {
+	dir := os.Getenv(env.SSXRecordDir)
+	if dir == "" {
+		dir = defaultRecordDir
+	}
+	return utils.ExpandHomeDir(dir)
+}
+
+// recorder tees the output of interactive session into an asciicast file,
+// nothing is recorded before start is called
+type recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	cast *asciicast.Writer
+	e    *entry.Entry
+}
+
+// newRecorder creates the recording file of e, which is named
+// <time>_<entry id>.cast so that recordings can be listed by entry,
+// a -<n> suffix is appended to the id if the name is taken already
+func newRecorder(e *entry.Entry) (*recorder, error) {
+	dir := RecordDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("%s_%s", time.Now().Format(recordTimeFormat), recordKey(e))
+	name := prefix + recordExt
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			return &recorder{file: f, e: e}, nil
+		}
+		if !os.IsExist(err) || i >= maxRecordSuffix {
+			return nil, errors.Wrap(err, "failed to create recording")
+		}
+		name = fmt.Sprintf("%s-%d%s", prefix, i, recordExt)
+	}
+}
+
+// recordKey returns the entry id of e used in recording names, entries of
+// ssh config have no id, their host alias is used instead
+func recordKey(e *entry.Entry) string {
+	if e.ID > 0 || len(e.Tags) == 0 {
+		return strconv.FormatUint(e.ID, 10)
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-", r) {
+			return r
+		}
+		return '_'
+	}, e.Tags[0])
+}
+
+func (r *recorder) start(width, height int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cast, err := asciicast.NewWriter(r.file, &asciicast.Header{
+		Width:  width,
+		Height: height,
+		Title:  r.e.String(),
+		Env:    map[string]string{"TERM": "xterm"},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to write recording")
+	}
+	r.cast = cast
+	lg.Info("recording session to %s", r.file.Name())
+	return nil
+}
+
+// Write never fails, otherwise the output of session stops
+func (r *recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cast == nil {
+		return len(p), nil
+	}
+	if _, err := r.cast.Write(p); err != nil {
+		lg.Error("failed to write recording, stop recording: %s", err)
+		r.cast = nil
+	}
+	return len(p), nil
+}
+
+func (r *recorder) resize(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cast == nil {
+		return
+	}
+	if err := r.cast.Resize(width, height); err != nil {
+		lg.Error("failed to write recording, stop recording: %s", err)
+		r.cast = nil
+	}
+}
+
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cast = nil
+	_ = r.file.Close()
+}
+
+// discard stops recording and removes the recording file
+func (r *recorder) discard() {
+	r.close()
+	if err := os.Remove(r.file.Name()); err != nil {
+		lg.Debug("failed to remove recording: %s", err)
+	}
+}
+
+// recordedSession records window changes of the session
+type recordedSession struct {
+	*ssh.Session
+	rec *recorder
+}
+
+func (s *recordedSession) WindowChange(h, w int) error {
+	s.rec.resize(w, h)
+	return s.Session.WindowChange(h, w)
+}
+
+// Recording is the summary of a recording file
+type Recording struct {
+	File     string
+	EntryID  uint64
+	Address  string
+	Started  time.Time
+	Duration time.Duration
+}
+
+// ListRecordings returns recordings of entry with id, or all of them if id is 0,
+// the latest is the first
+func ListRecordings(id uint64) ([]*Recording, error) {
+	dir := RecordDir()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+recordExt))
+	if err != nil {
+		return nil, err
+	}
+	var recordings []*Recording
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), recordExt)
+		ts, idStr, ok := strings.Cut(name, "_")
+		if !ok {
+			continue
+		}
+		idStr, _, _ = strings.Cut(idStr, "-")
+		// named by host alias if not a number
+		entryID, _ := strconv.ParseUint(idStr, 10, 64)
+		if id > 0 && entryID != id {
+			continue
+		}
+		rec, err := readRecording(file)
+		if err != nil {
+			lg.Warn("skip %s: %s", file, err)
+			continue
+		}
+		rec.EntryID = entryID
+		if rec.Started.IsZero() {
+			rec.Started, _ = time.ParseInLocation(recordTimeFormat, ts, time.Local)
+		}
+		recordings = append(recordings, rec)
+	}
+	sort.SliceStable(recordings, func(i, j int) bool {
+		return recordings[i].Started.After(recordings[j].Started)
+	})
+	return recordings, nil
+}
+
+func readRecording(file string) (*Recording, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := asciicast.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	d, err := r.Duration()
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{File: file, Address: r.Header.Title, Duration: d}
+	if r.Header.Timestamp > 0 {
+		rec.Started = time.Unix(r.Header.Timestamp, 0)
+	}
+	return rec, nil
+}
+
+// PrintRecordings lists recordings of entry with id, or all of them if id is 0
+func PrintRecordings(id uint64) error {
+	recordings, err := ListRecordings(id)
+	if err != nil {
+		return err
+	}
+	if len(recordings) == 0 {
+		fmt.Printf("No recordings found in %s\n", RecordDir())
+		return nil
+	}
+	header := []string{"ID", "Address", "Started", "Duration", "File"}
+	var rows [][]string
+	for _, r := range recordings {
+		id := ""
+		if r.EntryID > 0 {
+			id = strconv.FormatUint(r.EntryID, 10)
+		}
+		rows = append(rows, []string{
+			id, r.Address,
+			r.Started.Format("2006-01-02 15:04:05"),
+			r.Duration.Round(time.Second).String(),
+			filepath.Base(r.File),
+		})
+	}
+	tui.PrintTable(header, rows)
+	return nil
+}
+
+// Replay plays back the recording file, which is looked up in
+// RecordDir as well if not found
+func Replay(ctx context.Context, file string, speed float64, idleLimit time.Duration) error {
+	if !utils.FileExists(file) {
+		if inDir := filepath.Join(RecordDir(), file); utils.FileExists(inDir) {
+			file = inDir
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := asciicast.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", file)
+	}
+	lg.Debug("replaying %s, recorded on %dx%d terminal", file, r.Header.Width, r.Header.Height)
+	return asciicast.Play(ctx, r, os.Stdout, speed, idleLimit)
+}
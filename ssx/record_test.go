@@ -0,0 +1,87 @@
+package ssx
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+func TestNewRecorder(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(env.SSXRecordDir, dir)
+	e := &entry.Entry{ID: 3, Host: "10.0.0.1", Port: "22", User: "root"}
+
+	// recordings of the same second do not collide
+	var files []string
+	for i := 0; i < 3; i++ {
+		rec, err := newRecorder(e)
+		if err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		if err = rec.start(80, 24); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		rec.close()
+		files = append(files, rec.file.Name())
+	}
+	assert.Len(t, files, 3)
+	assert.NotEqual(t, files[0], files[1])
+	assert.NotEqual(t, files[1], files[2])
+
+	recordings, err := ListRecordings(3)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Len(t, recordings, 3)
+
+	rec, err := newRecorder(e)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	rec.discard()
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+recordExt))
+	assert.Len(t, matches, 3)
+}
+
+func TestNewRecorder_sshConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(env.SSXRecordDir, dir)
+	web := &entry.Entry{Host: "10.0.0.1", Port: "22", User: "root", Tags: []string{"web"}, Source: entry.SourceSSHConfig}
+	db := &entry.Entry{Host: "10.0.0.2", Port: "22", User: "root", Tags: []string{"db/1"}, Source: entry.SourceSSHConfig}
+	stored := &entry.Entry{ID: 3, Host: "10.0.0.3", Port: "22", User: "root"}
+
+	var names []string
+	for _, e := range []*entry.Entry{web, db, stored} {
+		rec, err := newRecorder(e)
+		if err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		if err = rec.start(80, 24); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+		rec.close()
+		names = append(names, filepath.Base(rec.file.Name()))
+	}
+	// named by host alias instead of id 0
+	assert.True(t, strings.HasSuffix(names[0], "_web"+recordExt), names[0])
+	assert.True(t, strings.HasSuffix(names[1], "_db_1"+recordExt), names[1])
+	assert.True(t, strings.HasSuffix(names[2], "_3"+recordExt), names[2])
+
+	recordings, err := ListRecordings(0)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Len(t, recordings, 3)
+	recordings, err = ListRecordings(3)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if assert.Len(t, recordings, 1) {
+		assert.Equal(t, uint64(3), recordings[0].EntryID)
+	}
+}
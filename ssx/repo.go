@@ -3,6 +3,8 @@ package ssx
 import (
 	"github.com/vimiix/ssx/ssx/bbolt"
 	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/history"
+	"github.com/vimiix/ssx/ssx/snippet"
 )
 
 // Repo define a KV store interface
@@ -11,9 +13,15 @@ type Repo interface {
 	GetMetadata(key []byte) ([]byte, error)
 	SetMetadata(key []byte, value []byte) error
 	TouchEntry(e *entry.Entry) (err error)
+	SaveEntry(e *entry.Entry) error
 	GetEntry(id uint64) (*entry.Entry, error)
 	GetAllEntries() (map[uint64]*entry.Entry, error)
 	DeleteEntry(id uint64) error
+	AddHistory(h *history.Record, limit int) error
+	GetAllHistory() ([]*history.Record, error)
+	SaveSnippet(sn *snippet.Snippet) error
+	GetAllSnippets() ([]*snippet.Snippet, error)
+	DeleteSnippet(id uint64) error
 }
 
 var _ Repo = (*bbolt.Repo)(nil)
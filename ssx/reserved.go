@@ -11,6 +11,13 @@ var (
 		"u", "update",
 		"cp", "scp",
 		"stats", "top", "share",
+		"hostkey",
+		"mux",
+		"run",
+		"replay",
+		"recordings",
+		"history",
+		"snippet",
 		"ssx",
 	}
 	reservedWordsMap = map[string]bool{}
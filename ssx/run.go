@@ -0,0 +1,262 @@
+package ssx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/errmsg"
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/tui"
+	"github.com/vimiix/ssx/internal/utils"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/history"
+)
+
+// DefaultParallel is the default maximum number of entries running at the same time
+const DefaultParallel = 10
+
+// RunOption holds options for run command
+type RunOption struct {
+	Keyword  string
+	Tag      string
+	IDs      []int
+	Command  string
+	Parallel int
+	Timeout  time.Duration
+
+	TimeoutSignal string
+	GracePeriod   time.Duration
+}
+
+// RunResult is the result of running command on a single entry
+type RunResult struct {
+	Entry    *entry.Entry
+	ExitCode int // -1 if the command did not finish
+	Duration time.Duration
+	Err      error
+}
+
+// Run executes command on every entry matched by keyword, tag or ids concurrently,
+// output lines are prefixed with the entry and a summary is printed at last
+func (s *SSX) Run(ctx context.Context, opt *RunOption) error {
+	if opt.Command == "" {
+		return errors.New("no command specified")
+	}
+	timeoutSignal, err := ParseSignal(opt.TimeoutSignal)
+	if err != nil {
+		return err
+	}
+	entries, err := s.matchEntries(opt.Keyword, opt.Tag, opt.IDs)
+	if err != nil {
+		return err
+	}
+	results := s.runEntries(ctx, entries, opt, timeoutSignal)
+
+	fmt.Println()
+	printRunResults(results)
+
+	var failed int
+	for _, r := range results {
+		if r.Err != nil || r.ExitCode != 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d hosts failed", failed, len(results))
+	}
+	return nil
+}
+
+// runEntries runs command on entries, at most opt.Parallel of them at the same time
+func (s *SSX) runEntries(ctx context.Context, entries []*entry.Entry, opt *RunOption, timeoutSignal ssh.Signal) []*RunResult {
+	parallel := opt.Parallel
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+	lg.Debug("running %q on %d entries, parallel %d", opt.Command, len(entries), parallel)
+
+	var (
+		outMu   sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, parallel)
+		results = make([]*RunResult, len(entries))
+		width   int
+	)
+	for _, e := range entries {
+		width = max(width, len(e.String()))
+	}
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *entry.Entry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prefix := color.CyanString("[%-*s]", width, e.String()) + " "
+			stdout := &prefixWriter{mu: &outMu, w: os.Stdout, prefix: prefix}
+			stderr := &prefixWriter{mu: &outMu, w: os.Stderr, prefix: prefix}
+			results[i] = s.runOn(ctx, e, &ExecuteOption{
+				Command: opt.Command,
+				Stdout:  stdout,
+				Stderr:  stderr,
+				Timeout: opt.Timeout,
+
+				TimeoutSignal: timeoutSignal,
+				GracePeriod:   opt.GracePeriod,
+			})
+			stdout.Flush()
+			stderr.Flush()
+		}(i, e)
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *SSX) runOn(ctx context.Context, e *entry.Entry, opt *ExecuteOption) *RunResult {
+	start := time.Now()
+	h := newHistory(e, history.ModeExec, opt.Command)
+	err := s.newClient(e).Execute(ctx, opt)
+	s.saveHistory(h, e, err)
+	res := &RunResult{Entry: e, Duration: time.Since(start)}
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitStatus()
+	default:
+		res.ExitCode = -1
+		res.Err = err
+		_, _ = fmt.Fprintln(opt.Stderr, color.RedString(err.Error()))
+	}
+	return res
+}
+
+func printRunResults(results []*RunResult) {
+	header := []string{"ID", "Address", "Exit Code", "Duration", "Error"}
+	var rows [][]string
+	for _, r := range results {
+		id, code, errMsg := "", "-", ""
+		if r.Entry.ID > 0 {
+			id = strconv.FormatUint(r.Entry.ID, 10)
+		}
+		if r.ExitCode >= 0 {
+			code = strconv.Itoa(r.ExitCode)
+		}
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		rows = append(rows, []string{id, r.Entry.String(), code, r.Duration.Round(time.Millisecond).String(), errMsg})
+	}
+	tui.PrintTable(header, rows)
+}
+
+// matchEntries returns all entries matched by keyword, tag or ids,
+// unlike GetEntry no one is selected among the candidates
+func (s *SSX) matchEntries(keyword, tag string, ids []int) ([]*entry.Entry, error) {
+	var (
+		matched []*entry.Entry
+		seen    = map[string]bool{}
+	)
+	add := func(es ...*entry.Entry) {
+		for _, e := range es {
+			// entries of ~/.ssh/config have no ID, which are unique by address
+			key := strconv.FormatUint(e.ID, 10)
+			if e.ID == 0 {
+				key = e.String()
+			}
+			if !seen[key] {
+				seen[key] = true
+				matched = append(matched, e)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		e, err := s.repo.GetEntry(uint64(id))
+		if err != nil {
+			return nil, errors.Wrapf(err, "entry %d", id)
+		}
+		add(e)
+	}
+	if tag != "" {
+		em, err := s.repo.GetAllEntries()
+		if err != nil {
+			return nil, err
+		}
+		add(foundTargetByTag(em, tag)...)
+		add(foundTargetByTag(s.sshEntryMap, tag)...)
+	}
+	if keyword != "" {
+		es, err := s.getAllEntries()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range es {
+			if utils.ContainsI(e.String(), keyword) ||
+				utils.ContainsI(strings.Join(e.Tags, " "), keyword) {
+				add(e)
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, errmsg.ErrNoEntry
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].ID != matched[j].ID {
+			return matched[i].ID < matched[j].ID
+		}
+		return matched[i].String() < matched[j].String()
+	})
+	return matched, nil
+}
+
+// prefixWriter writes every line with prefix to w, an incomplete
+// line is held until the line ending or Flush is called
+type prefixWriter struct {
+	mu     *sync.Mutex // shared by writers of the same output
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes the incomplete line if any
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		_ = p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := io.WriteString(p.w, p.prefix+string(line))
+	return err
+}
@@ -0,0 +1,155 @@
+package ssx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vimiix/ssx/internal/errmsg"
+	"github.com/vimiix/ssx/ssx/bbolt"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/env"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		out bytes.Buffer
+	)
+	w := &prefixWriter{mu: &mu, w: &out, prefix: "[h1] "}
+	n, err := w.Write([]byte("line1\nli"))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, "[h1] line1\n", out.String())
+
+	_, _ = w.Write([]byte("ne2\nline3"))
+	assert.Equal(t, "[h1] line1\n[h1] line2\n", out.String())
+
+	w.Flush()
+	assert.Equal(t, "[h1] line1\n[h1] line2\n[h1] line3\n", out.String())
+	w.Flush()
+	assert.Equal(t, "[h1] line1\n[h1] line2\n[h1] line3\n", out.String())
+}
+
+func newRunTestSSX(t *testing.T, es ...*entry.Entry) *SSX {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(env.SSXMux, "")
+	repo := bbolt.NewRepo(filepath.Join(t.TempDir(), "ssx.db"))
+	if err := repo.Init(); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	for _, e := range es {
+		e.Source = entry.SourceSSXStore
+		if err := repo.TouchEntry(e); err != nil {
+			t.Fatalf("Received unexpected error:\n%+v", err)
+		}
+	}
+	return &SSX{repo: repo, sshEntryMap: map[string]*entry.Entry{}}
+}
+
+func TestMatchEntries(t *testing.T) {
+	web1 := &entry.Entry{Host: "10.0.0.1", Port: "22", User: "root", Tags: []string{"web"}}
+	web2 := &entry.Entry{Host: "10.0.0.2", Port: "22", User: "root", Tags: []string{"web", "db"}}
+	// the same address as web1, but another entry
+	cache := &entry.Entry{Host: "10.0.0.1", Port: "22", User: "root", Tags: []string{"cache"}}
+	s := newRunTestSSX(t, web1, web2, cache)
+	sshWeb := &entry.Entry{Host: "10.0.1.1", Port: "22", User: "admin", Tags: []string{"web3"}, Source: entry.SourceSSHConfig}
+	s.sshEntryMap[sshWeb.String()] = sshWeb
+
+	tests := []struct {
+		name    string
+		keyword string
+		tag     string
+		ids     []int
+		want    []string
+	}{
+		{"tag", "", "web", nil, []string{"admin@10.0.1.1:22", "1", "2"}},
+		{"keyword of address", "10.0.0.1", "", nil, []string{"1", "3"}},
+		{"keyword of tag", "cache", "", nil, []string{"3"}},
+		{"ids", "", "", []int{3, 1}, []string{"1", "3"}},
+		{"dedupe", "10.0.0", "db", []int{2, 2}, []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, err := s.matchEntries(tt.keyword, tt.tag, tt.ids)
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			var got []string
+			for _, e := range es {
+				if e.ID == 0 {
+					got = append(got, e.String())
+				} else {
+					got = append(got, strconv.FormatUint(e.ID, 10))
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := s.matchEntries("10.9.9.9", "", nil)
+	assert.ErrorIs(t, err, errmsg.ErrNoEntry)
+	_, err = s.matchEntries("", "", []int{100})
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	srv := startTestServer(t)
+	var (
+		mu           sync.Mutex
+		active, peak int
+		commands     []string
+	)
+	srv.exec = func(user, command string, stdout io.Writer) int {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		commands = append(commands, command)
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		_, _ = io.WriteString(stdout, "hello from "+user+"\n")
+		if user == "u3" {
+			return 3
+		}
+		return 0
+	}
+	var es []*entry.Entry
+	for _, user := range []string{"u1", "u2", "u3", "u4", "u5"} {
+		es = append(es, &entry.Entry{
+			Host:          srv.host,
+			Port:          srv.port,
+			User:          user,
+			Password:      "secret",
+			DisableAgent:  true,
+			HostKeyPolicy: entry.HostKeyPolicyOff,
+		})
+	}
+	s := newRunTestSSX(t, es...)
+	opt := &RunOption{Keyword: srv.host, Command: "uptime", Parallel: 2}
+
+	err := s.Run(context.Background(), opt)
+	assert.EqualError(t, err, "1 of 5 hosts failed")
+	assert.Equal(t, ExitCodeError, ExitCode(err))
+	assert.Equal(t, 2, peak)
+	assert.Len(t, commands, 5)
+
+	results := s.runEntries(context.Background(), es, opt, "")
+	for _, r := range results {
+		assert.NoError(t, r.Err, r.Entry.User)
+		want := 0
+		if r.Entry.User == "u3" {
+			want = 3
+		}
+		assert.Equal(t, want, r.ExitCode, r.Entry.User)
+	}
+}
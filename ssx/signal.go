@@ -0,0 +1,133 @@
+package ssx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vimiix/ssx/internal/lg"
+)
+
+const (
+	defaultTimeoutSignal = ssh.SIGTERM
+	defaultGracePeriod   = 5 * time.Second
+)
+
+// SignalCause is the cause of context canceled by a received signal
+type SignalCause struct {
+	Signal ssh.Signal
+}
+
+func (c *SignalCause) Error() string {
+	return fmt.Sprintf("received signal SIG%s", c.Signal)
+}
+
+// NotifyContext works like signal.NotifyContext, but the received signal
+// is recorded as the cause of ctx so that it can be forwarded to remote.
+// Signals received after the first one are ignored rather than killing ssx,
+// until the returned stop is called once the cleanup has finished.
+func NotifyContext(parent context.Context, signals ...os.Signal) (ctx context.Context, stop context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			cancel(&SignalCause{Signal: sshSignal(sig)})
+		case <-done:
+			return
+		}
+		for {
+			select {
+			case sig := <-ch:
+				lg.Debug("ignore signal %s while cleaning up", sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+		cancel(nil)
+	}
+}
+
+func sshSignal(sig os.Signal) ssh.Signal {
+	switch sig {
+	case syscall.SIGINT:
+		return ssh.SIGINT
+	case syscall.SIGQUIT:
+		return ssh.SIGQUIT
+	case syscall.SIGHUP:
+		return ssh.SIGHUP
+	default:
+		return ssh.SIGTERM
+	}
+}
+
+// ParseSignal parses signal name like TERM, SIGTERM or term,
+// empty name means the default one
+func ParseSignal(name string) (ssh.Signal, error) {
+	if name == "" {
+		return "", nil
+	}
+	sig := strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	if _, ok := signalNumbers[sig]; !ok {
+		return "", errors.Errorf("unsupported signal %q", name)
+	}
+	return ssh.Signal(sig), nil
+}
+
+// terminateOnDone sends signal to the remote process of sess once ctx is done,
+// the received one if ctx is canceled by signal, otherwise sig. sess is closed
+// if the process does not exit within grace period after that.
+// The returned stop should be called after the process exited.
+func terminateOnDone(ctx context.Context, sess *ssh.Session, sig ssh.Signal, grace time.Duration) (stop func()) {
+	if sig == "" {
+		sig = defaultTimeoutSignal
+	}
+	if grace <= 0 {
+		grace = defaultGracePeriod
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		var cause *SignalCause
+		if errors.As(context.Cause(ctx), &cause) {
+			sig = cause.Signal
+		}
+		lg.Debug("sending signal %s to remote process: %s", sig, context.Cause(ctx))
+		if err := sess.Signal(sig); err != nil {
+			lg.Debug("failed to send signal: %s", err)
+		}
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			lg.Warn("remote process did not exit within %s after SIG%s, close the session", grace, sig)
+			_ = sess.Close()
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,70 @@
+package ssx
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    ssh.Signal
+		wantErr bool
+	}{
+		{"", "", false},
+		{"TERM", ssh.SIGTERM, false},
+		{"SIGKILL", ssh.SIGKILL, false},
+		{"int", ssh.SIGINT, false},
+		{"sigquit", ssh.SIGQUIT, false},
+		{"FOO", "", true},
+		{"9", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSignal(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Received unexpected error:\n%+v", err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNotifyContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending signals is not supported on windows")
+	}
+	ctx, stop := NotifyContext(context.Background(), syscall.SIGHUP)
+	defer stop()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if err = p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context is not canceled by signal")
+	}
+	assert.Equal(t, &SignalCause{Signal: ssh.SIGHUP}, context.Cause(ctx))
+
+	// the second signal does not kill the process before stop
+	if err = p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, &SignalCause{Signal: ssh.SIGHUP}, context.Cause(ctx))
+}
@@ -0,0 +1,148 @@
+package ssx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vimiix/ssx/internal/lg"
+	"github.com/vimiix/ssx/internal/tui"
+	"github.com/vimiix/ssx/ssx/entry"
+	"github.com/vimiix/ssx/ssx/snippet"
+)
+
+// SnippetRunOption holds options for running a snippet on an entry
+type SnippetRunOption struct {
+	Name    string
+	Keyword string
+	EntryID uint64
+	Params  []string // KEY=VALUE
+	Timeout time.Duration
+}
+
+// AddSnippet saves sn, the snippet with the same name and scope is replaced
+func (s *SSX) AddSnippet(sn *snippet.Snippet) error {
+	if err := sn.Validate(); err != nil {
+		return err
+	}
+	if sn.EntryID > 0 {
+		if _, err := s.repo.GetEntry(sn.EntryID); err != nil {
+			return err
+		}
+	}
+	snippets, err := s.repo.GetAllSnippets()
+	if err != nil {
+		return err
+	}
+	sn.CreateAt = time.Now()
+	if exist := findSnippetInScope(snippets, sn); exist != nil {
+		sn.ID = exist.ID
+		lg.Info("replacing snippet %q of %s", sn.Name, sn.Scope())
+	}
+	if err = s.repo.SaveSnippet(sn); err != nil {
+		return err
+	}
+	lg.Info("snippet %q of %s saved", sn.Name, sn.Scope())
+	return nil
+}
+
+// DeleteSnippet deletes the snippet with name in the scope of entry id or tag,
+// or the global one if neither is set
+func (s *SSX) DeleteSnippet(name string, entryID uint64, tag string) error {
+	snippets, err := s.repo.GetAllSnippets()
+	if err != nil {
+		return err
+	}
+	target := &snippet.Snippet{Name: name, EntryID: entryID, Tag: tag}
+	exist := findSnippetInScope(snippets, target)
+	if exist == nil {
+		return errors.Errorf("snippet %q of %s not found", name, target.Scope())
+	}
+	if err = s.repo.DeleteSnippet(exist.ID); err != nil {
+		return err
+	}
+	lg.Info("snippet %q of %s deleted", name, exist.Scope())
+	return nil
+}
+
+func findSnippetInScope(snippets []*snippet.Snippet, target *snippet.Snippet) *snippet.Snippet {
+	for _, sn := range snippets {
+		if sn.Name == target.Name && sn.SameScope(target) {
+			return sn
+		}
+	}
+	return nil
+}
+
+// ListSnippets prints the snippets available on the entry with id if set,
+// or attached to tag if set, otherwise all of them
+func (s *SSX) ListSnippets(entryID uint64, tag string) error {
+	snippets, err := s.repo.GetAllSnippets()
+	if err != nil {
+		return err
+	}
+	var e *entry.Entry
+	if entryID > 0 {
+		if e, err = s.repo.GetEntry(entryID); err != nil {
+			return err
+		}
+	}
+	var matched []*snippet.Snippet
+	for _, sn := range snippets {
+		if e != nil && !sn.Match(e) {
+			continue
+		}
+		if tag != "" && sn.Tag != tag {
+			continue
+		}
+		matched = append(matched, sn)
+	}
+	if len(matched) == 0 {
+		fmt.Println("No snippets found")
+		return nil
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Name < matched[j].Name
+	})
+	header := []string{"ID", "Name", "Scope", "Command"}
+	var rows [][]string
+	for _, sn := range matched {
+		rows = append(rows, []string{
+			strconv.FormatUint(sn.ID, 10), sn.Name, sn.Scope(), sn.Command,
+		})
+	}
+	tui.PrintTable(header, rows)
+	return nil
+}
+
+// snippetCommand renders the snippet named name available on e
+func (s *SSX) snippetCommand(e *entry.Entry, name string, params []string) (string, error) {
+	m, err := snippet.ParseParams(params)
+	if err != nil {
+		return "", err
+	}
+	snippets, err := s.repo.GetAllSnippets()
+	if err != nil {
+		return "", err
+	}
+	sn := snippet.Find(snippets, name, e)
+	if sn == nil {
+		return "", errors.Errorf("snippet %q not found for %s, see 'ssx snippet list'", name, e.String())
+	}
+	lg.Debug("using snippet %q of %s", name, sn.Scope())
+	return sn.Render(e, m)
+}
+
+// RunSnippet executes the snippet on the entry matched by keyword or id
+func (s *SSX) RunSnippet(ctx context.Context, opt *SnippetRunOption) error {
+	s.opt.Keyword = opt.Keyword
+	s.opt.EntryID = opt.EntryID
+	s.opt.Snippet = opt.Name
+	s.opt.SnippetParams = opt.Params
+	s.opt.Timeout = opt.Timeout
+	return s.Main(ctx)
+}
@@ -0,0 +1,153 @@
+// Package snippet defines saved commands which can be run on entries
+package snippet
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vimiix/ssx/internal/utils"
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// funcs are the functions available in command template
+var funcs = template.FuncMap{
+	"quote": func(v any) string {
+		return utils.ShellQuote(fmt.Sprint(v))
+	},
+}
+
+// Snippet is a command template, which is global, or attached to
+// an entry or entries with a tag
+type Snippet struct {
+	ID       uint64    `json:"id"`
+	Name     string    `json:"name"`
+	Command  string    `json:"command"`            // text/template with entry fields and parameters, e.g. {{.Host}}
+	EntryID  uint64    `json:"entry_id,omitempty"` // attached to the entry if set
+	Tag      string    `json:"tag,omitempty"`      // attached to entries with the tag if set
+	CreateAt time.Time `json:"create_at"`
+}
+
+// Validate checks name and command template of the snippet
+func (s *Snippet) Validate() error {
+	if !nameRegexp.MatchString(s.Name) {
+		return errors.Errorf("invalid snippet name %q, only letters, digits, '_', '-' and '.' are allowed", s.Name)
+	}
+	if strings.TrimSpace(s.Command) == "" {
+		return errors.New("snippet command can not be empty")
+	}
+	if s.EntryID > 0 && s.Tag != "" {
+		return errors.New("snippet can not be attached to both entry and tag")
+	}
+	if _, err := s.parse(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Scope describes what the snippet is attached to
+func (s *Snippet) Scope() string {
+	if s.EntryID > 0 {
+		return fmt.Sprintf("entry %d", s.EntryID)
+	}
+	if s.Tag != "" {
+		return fmt.Sprintf("tag %s", s.Tag)
+	}
+	return "global"
+}
+
+// SameScope reports whether s and other are attached to the same target
+func (s *Snippet) SameScope(other *Snippet) bool {
+	return s.EntryID == other.EntryID && s.Tag == other.Tag
+}
+
+// Match reports whether the snippet is available on e
+func (s *Snippet) Match(e *entry.Entry) bool {
+	if s.EntryID > 0 {
+		return e.Source == entry.SourceSSXStore && s.EntryID == e.ID
+	}
+	if s.Tag != "" {
+		return slices.Contains(e.Tags, s.Tag)
+	}
+	return true
+}
+
+// priority of snippets with the same name, the more specific the higher
+func (s *Snippet) priority() int {
+	if s.EntryID > 0 {
+		return 2
+	}
+	if s.Tag != "" {
+		return 1
+	}
+	return 0
+}
+
+// Render returns the command to run on e, in which fields of e are available
+// as {{.ID}}, {{.Host}}, {{.Port}}, {{.User}} and {{.Address}}, and params
+// as {{.KEY}}, which take precedence over the fields of e. Values are not
+// escaped, {{quote .KEY}} passes the value to shell as a single argument.
+func (s *Snippet) Render(e *entry.Entry, params map[string]string) (string, error) {
+	tmpl, err := s.parse()
+	if err != nil {
+		return "", err
+	}
+	data := map[string]any{
+		"ID":      e.ID,
+		"Host":    e.Host,
+		"Port":    e.Port,
+		"User":    e.User,
+		"Address": e.String(),
+	}
+	for k, v := range params {
+		data[k] = v
+	}
+	var buf strings.Builder
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "failed to render snippet %q, missing parameter?", s.Name)
+	}
+	return buf.String(), nil
+}
+
+func (s *Snippet) parse() (*template.Template, error) {
+	tmpl, err := template.New(s.Name).Option("missingkey=error").Funcs(funcs).Parse(s.Command)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid snippet command")
+	}
+	return tmpl, nil
+}
+
+// Find returns the snippet named name available on e, the one attached
+// to the entry is preferred, then the one attached to its tags, then the global one
+func Find(snippets []*Snippet, name string, e *entry.Entry) *Snippet {
+	var found *Snippet
+	for _, s := range snippets {
+		if s.Name != name || !s.Match(e) {
+			continue
+		}
+		if found == nil || s.priority() > found.priority() {
+			found = s
+		}
+	}
+	return found
+}
+
+// ParseParams parses parameters in KEY=VALUE format
+func ParseParams(params []string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, p := range params {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, errors.Errorf("invalid snippet parameter %q, expect KEY=VALUE", p)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
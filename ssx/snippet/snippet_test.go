@@ -0,0 +1,63 @@
+package snippet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+func TestFind(t *testing.T) {
+	snippets := []*Snippet{
+		{ID: 1, Name: "disk", Command: "df -h"},
+		{ID: 2, Name: "disk", Command: "df -h /data", Tag: "db"},
+		{ID: 3, Name: "disk", Command: "df -h /srv", EntryID: 2},
+		{ID: 4, Name: "logs", Command: "tail app.log", Tag: "web"},
+	}
+	e1 := &entry.Entry{ID: 1, Tags: []string{"db"}, Source: entry.SourceSSXStore}
+	e2 := &entry.Entry{ID: 2, Tags: []string{"db"}, Source: entry.SourceSSXStore}
+	e3 := &entry.Entry{ID: 3, Source: entry.SourceSSXStore}
+
+	assert.Equal(t, uint64(2), Find(snippets, "disk", e1).ID)
+	assert.Equal(t, uint64(3), Find(snippets, "disk", e2).ID)
+	assert.Equal(t, uint64(1), Find(snippets, "disk", e3).ID)
+	assert.Nil(t, Find(snippets, "logs", e3))
+}
+
+func TestRender(t *testing.T) {
+	e := &entry.Entry{ID: 1, Host: "10.0.0.1", Port: "22", User: "root"}
+	s := &Snippet{Name: "tail", Command: "tail -n {{.Lines}} /var/log/{{.Host}}.log"}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	params, err := ParseParams([]string{"Lines=100"})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	cmd, err := s.Render(e, params)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, "tail -n 100 /var/log/10.0.0.1.log", cmd)
+
+	_, err = s.Render(e, nil)
+	assert.Error(t, err)
+	_, err = ParseParams([]string{"Lines"})
+	assert.Error(t, err)
+	assert.Error(t, (&Snippet{Name: "bad name", Command: "ls"}).Validate())
+	assert.Error(t, (&Snippet{Name: "bad", Command: "{{.Host"}).Validate())
+}
+
+func TestRenderQuote(t *testing.T) {
+	e := &entry.Entry{ID: 1, Host: "10.0.0.1", Port: "22", User: "root"}
+	s := &Snippet{Name: "grep", Command: "grep -r {{quote .Pattern}} /var/log/{{quote .Host}}"}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	cmd, err := s.Render(e, map[string]string{"Pattern": "it's $(reboot)"})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, `grep -r 'it'\''s $(reboot)' /var/log/'10.0.0.1'`, cmd)
+}
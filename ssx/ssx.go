@@ -19,25 +19,40 @@ import (
 	"github.com/vimiix/ssx/internal/errmsg"
 	"github.com/vimiix/ssx/internal/lg"
 	"github.com/vimiix/ssx/internal/slice"
+	"github.com/vimiix/ssx/internal/terminal"
 	"github.com/vimiix/ssx/internal/tui"
 	"github.com/vimiix/ssx/internal/utils"
 	"github.com/vimiix/ssx/ssx/bbolt"
 	"github.com/vimiix/ssx/ssx/entry"
 	"github.com/vimiix/ssx/ssx/env"
+	"github.com/vimiix/ssx/ssx/history"
 )
 
 type CmdOption struct {
-	DBFile       string
-	EntryID      uint64
-	Addr         string
-	Tag          string
-	IdentityFile string
-	JumpServers  string
-	Keyword      string
-	Command      string
-	Timeout      time.Duration
-	Port         int
-	Unsafe       bool
+	DBFile          string
+	EntryID         uint64
+	Addr            string
+	Tag             string
+	IdentityFile    string
+	JumpServers     string
+	Keyword         string
+	Command         string
+	Timeout         time.Duration
+	Port            int
+	Unsafe          bool
+	LocalForwards   []string
+	RemoteForwards  []string
+	DynamicForwards []string
+	NoCommand       bool
+	ForceTTY        bool
+	DisableTTY      bool
+	TimeoutSignal   string
+	GracePeriod     time.Duration
+	Record          bool
+	Reconnect       bool
+	NoStartup       bool     // skip the startup command of entry
+	Snippet         string   // name of snippet to run instead of command
+	SnippetParams   []string // KEY=VALUE parameters of snippet
 }
 
 // Tidy complete unset fields with default values
@@ -266,7 +281,7 @@ func (s *SSX) GetEntry(opt *CmdOption) (*entry.Entry, error) {
 	}
 }
 
-func (s *SSX) Main(ctx context.Context) error {
+func (s *SSX) Main(ctx context.Context) (err error) {
 	e, err := s.GetEntry(s.opt)
 	if err != nil {
 		return err
@@ -277,13 +292,103 @@ func (s *SSX) Main(ctx context.Context) error {
 		e.KeyPath = s.opt.IdentityFile
 	}
 
-	client := NewClient(e, s.repo)
-	if len(s.opt.Command) > 0 {
+	if s.opt.Snippet != "" {
+		if len(s.opt.Command) > 0 {
+			return errors.New("no command should be specified with snippet")
+		}
+		if s.opt.Command, err = s.snippetCommand(e, s.opt.Snippet, s.opt.SnippetParams); err != nil {
+			return err
+		}
+	}
+	if s.opt.NoCommand && len(s.opt.Command) > 0 {
+		return errors.New("no command should be specified with -N")
+	}
+	if s.opt.ForceTTY && s.opt.DisableTTY {
+		return errors.New("--tty and -T can not be specified at the same time")
+	}
+	timeoutSignal, err := ParseSignal(s.opt.TimeoutSignal)
+	if err != nil {
+		return err
+	}
+	localForwards, err := parseForwards(s.opt.LocalForwards, "localhost")
+	if err != nil {
+		return err
+	}
+	remoteForwards, err := parseForwards(s.opt.RemoteForwards, "localhost")
+	if err != nil {
+		return err
+	}
+	var socksListens []Endpoint
+	for _, spec := range s.opt.DynamicForwards {
+		ep, err := ParseDynamicForward(spec, "localhost")
+		if err != nil {
+			return err
+		}
+		socksListens = append(socksListens, ep)
+	}
+
+	mode := history.ModeInteractive
+	if s.opt.NoCommand {
+		mode = history.ModeForward
+	} else if len(s.opt.Command) > 0 {
+		mode = history.ModeExec
+	}
+	h := newHistory(e, mode, s.opt.Command)
+	defer func() {
+		s.saveHistory(h, e, err)
+	}()
+
+	client := s.newClient(e)
+	client.record = s.opt.Record || e.Record
+	client.autoReconnect = s.opt.Reconnect
+	if !s.opt.NoStartup {
+		client.startupCommand = e.StartupCommand
+	}
+	if len(remoteForwards) > 0 {
+		// forwarded connections can not be routed back through mux master
+		client.dialMux = nil
+	}
+	for _, fw := range localForwards {
+		if err = client.LocalForward(ctx, fw); err != nil {
+			client.close()
+			return err
+		}
+	}
+	for _, fw := range remoteForwards {
+		if err = client.RemoteForward(ctx, fw); err != nil {
+			client.close()
+			return err
+		}
+	}
+	for _, ep := range socksListens {
+		if err = client.DynamicForward(ctx, ep); err != nil {
+			client.close()
+			return err
+		}
+	}
+	if s.opt.NoCommand {
+		return client.Wait(ctx)
+	}
+	// like ssh, login shell runs without pseudo terminal if stdin is not a terminal,
+	// so that a script can be piped to it
+	if len(s.opt.Command) > 0 || s.opt.DisableTTY || !terminal.IsTerminal(os.Stdin) {
+		if s.opt.Record {
+			lg.Warn("only interactive sessions with terminal are recorded")
+		}
 		opt := &ExecuteOption{
 			Command: s.opt.Command,
 			Stdout:  os.Stdout,
 			Stderr:  os.Stderr,
 			Timeout: s.opt.Timeout,
+			TTY:     s.opt.ForceTTY,
+
+			TimeoutSignal: timeoutSignal,
+			GracePeriod:   s.opt.GracePeriod,
+		}
+		// stdin of terminal is forwarded only to the command with pseudo terminal,
+		// otherwise the input echoed by nobody would be consumed silently
+		if s.opt.ForceTTY || !terminal.IsTerminal(os.Stdin) {
+			opt.Stdin = os.Stdin
 		}
 		return client.Execute(ctx, opt)
 	}
@@ -637,7 +742,7 @@ func (s *SSX) DeleteTagByID(id int, tags ...string) error {
 			continue
 		}
 		e.Tags = slice.Delete(e.Tags, tags...)
-		if err = s.repo.TouchEntry(e); err != nil {
+		if err = s.repo.SaveEntry(e); err != nil {
 			return err
 		}
 		lg.Info("tags %s deleted", tags)
@@ -671,7 +776,7 @@ func (s *SSX) AppendTagByID(id int, tags ...string) error {
 			continue
 		}
 		e.Tags = slice.Union(e.Tags, tags)
-		if err = s.repo.TouchEntry(e); err != nil {
+		if err = s.repo.SaveEntry(e); err != nil {
 			return err
 		}
 		lg.Info("tags %s added", tags)
@@ -679,3 +784,25 @@ func (s *SSX) AppendTagByID(id int, tags ...string) error {
 	}
 	return errmsg.ErrEntryNotExist
 }
+
+// UpdateEntryByID applies changes to the stored entry and saves it back
+func (s *SSX) UpdateEntryByID(id int, changes ...func(e *entry.Entry) error) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	e, err := s.repo.GetEntry(uint64(id))
+	if err != nil {
+		return err
+	}
+	lg.Debug("updating entry %d", id)
+	for _, change := range changes {
+		if err = change(e); err != nil {
+			return err
+		}
+	}
+	if err = s.repo.SaveEntry(e); err != nil {
+		return err
+	}
+	lg.Info("entry %d updated", id)
+	return nil
+}
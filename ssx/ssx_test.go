@@ -0,0 +1,47 @@
+package ssx
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vimiix/ssx/ssx/bbolt"
+	"github.com/vimiix/ssx/ssx/entry"
+)
+
+// editing entries is not counted as a visit
+func TestEditEntry(t *testing.T) {
+	repo := bbolt.NewRepo(filepath.Join(t.TempDir(), "ssx.db"))
+	if err := repo.Init(); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	e := &entry.Entry{Host: "10.0.0.1", Port: "22", User: "root", Tags: []string{"web"}}
+	if err := repo.TouchEntry(e); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	s := &SSX{repo: repo}
+	id := int(e.ID)
+	if err := s.AppendTagByID(id, "prod"); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	if err := s.DeleteTagByID(id, "web"); err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	err := s.UpdateEntryByID(id, func(e *entry.Entry) error {
+		e.Port = "2222"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+
+	saved, err := repo.GetEntry(e.ID)
+	if err != nil {
+		t.Fatalf("Received unexpected error:\n%+v", err)
+	}
+	assert.Equal(t, []string{"prod"}, saved.Tags)
+	assert.Equal(t, "2222", saved.Port)
+	assert.Equal(t, 1, saved.VisitCount)
+	assert.True(t, e.UpdateAt.Equal(saved.UpdateAt))
+}